@@ -17,19 +17,61 @@ limitations under the License.
 package v1alpha1
 
 import (
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
 const (
 	MyAppResourceFinalizer = "myappresource.podinfo.podinfo.com"
 	MyAppResourceLabelName = "myappresource.podinfo.podinfo.com/name"
+
+	// MyAppResourceAdoptAnnotation, set on an existing object to the name of a MyAppResource, lets that
+	// MyAppResource take the object over as its child. Objects controlled by anything else are never adopted.
+	MyAppResourceAdoptAnnotation = "myappresource.podinfo.podinfo.com/adopt"
+)
+
+// Condition types reported in MyAppResourceStatus.Conditions.
+const (
+	// ConditionReady is True once the podinfo deployment (and Redis, when enabled) has rolled out the current spec.
+	ConditionReady = "Ready"
+
+	// ConditionProgressing is True while the podinfo deployment is rolling out a change.
+	ConditionProgressing = "Progressing"
+
+	// ConditionDegraded is True when the podinfo deployment failed to progress or to create replicas.
+	ConditionDegraded = "Degraded"
+
+	// ConditionRedisReady reports the Redis deployment's availability, or whether the address of an external Redis
+	// resolves. It is absent when Redis is disabled.
+	ConditionRedisReady = "RedisReady"
+
+	// ConditionRoutesAccepted is True once every parent of the podinfo Gateway API routes accepted them. It is absent
+	// when spec.gateway is unset.
+	ConditionRoutesAccepted = "RoutesAccepted"
+
+	// ConditionConflict is True while a child could not be written or deleted, because an object of the same name
+	// exists that the MyAppResource does not own.
+	ConditionConflict = "Conflict"
+
+	// ConditionTerminating is True while the myappresource is being deleted. Its reason reports the teardown step in
+	// progress: ScalingDown, RemovingRedis or RemovingChildren.
+	ConditionTerminating = "Terminating"
+
+	// ConditionReconcileError is True when the last reconcile failed to apply the desired state.
+	ConditionReconcileError = "ReconcileError"
 )
 
 // MyAppResourceSpec defines the desired state of MyAppResource
 type MyAppResourceSpec struct {
-	// ReplicaCount is the number of desired replicas of myappresource to launch.
-	ReplicaCount *int32 `json:"replicaCount"`
+	// ReplicaCount is the number of desired replicas of myappresource to launch. Defaults to 1.
+	// +optional
+	ReplicaCount *int32 `json:"replicaCount,omitempty"`
 
 	// Specify the myappresource image to run.
 	Image Image `json:"image"`
@@ -40,8 +82,42 @@ type MyAppResourceSpec struct {
 	// Redis deployment options.
 	Redis Redis `json:"redis,omitempty"`
 
+	// Autoscaling is the podinfo HorizontalPodAutoscaler spec. While enabled, the autoscaler owns the podinfo replica
+	// count and ReplicaCount is ignored.
+	// +optional
+	Autoscaling Autoscaling `json:"autoscaling,omitempty"`
+
 	// The podinfo deployment resources spec.
 	Resources Resources `json:"resources,omitempty" protobuf:"bytes,8,opt,name=resources"`
+
+	// Disruption is the PodDisruptionBudget spec bounding the podinfo pods taken down at once by voluntary
+	// disruptions, such as node drains. The budget is only kept while podinfo runs more than one replica.
+	// +optional
+	Disruption Disruption `json:"disruption,omitempty"`
+
+	// Probes are the health probes of the podinfo container, which check its /healthz and /readyz endpoints.
+	// +optional
+	Probes Probes `json:"probes,omitempty"`
+
+	// NetworkPolicy is the NetworkPolicies spec isolating the podinfo and Redis pods.
+	// +optional
+	NetworkPolicy NetworkPolicy `json:"networkPolicy,omitempty"`
+
+	// Ingress is the Ingress exposing the podinfo Service's http port. The Ingress is removed once this is unset.
+	// +optional
+	Ingress *Ingress `json:"ingress,omitempty"`
+
+	// Gateway is the Gateway API routes spec exposing the podinfo Service. The routes are removed once this is unset.
+	// +optional
+	Gateway *Gateway `json:"gateway,omitempty"`
+
+	// Monitoring is the Prometheus operator monitor spec scraping the podinfo metrics.
+	// +optional
+	Monitoring Monitoring `json:"monitoring,omitempty"`
+
+	// Alerting is the PrometheusRule spec for the default podinfo alerts.
+	// +optional
+	Alerting Alerting `json:"alerting,omitempty"`
 }
 
 // UI spec for User Interface options.
@@ -55,12 +131,346 @@ type UI struct {
 	Message string `json:"message,omitempty"`
 }
 
+// Redis spec for the podinfo cache. Redis runs as a single instance: podinfo reads and writes one cache server, so
+// scaling podinfo never starts more Redis instances.
 type Redis struct {
 	// Enable or disable redis usage.
 	Enabled bool `json:"enabled"`
 
+	// Image is the Redis image to run. Defaults to a pinned redis alpine image.
+	// +optional
+	Image *Image `json:"image,omitempty"`
+
 	// The Redis resources spec.
 	Resources Resources `json:"resources,omitempty" protobuf:"bytes,8,opt,name=resources"`
+
+	// Auth is the Redis password spec. While enabled, Redis requires a password and podinfo connects with it.
+	// +optional
+	Auth RedisAuth `json:"auth,omitempty"`
+
+	// Probes are the health probes of the Redis container: a TCP check of its port for liveness and startup, and a
+	// redis-cli PING for readiness.
+	// +optional
+	Probes Probes `json:"probes,omitempty"`
+
+	// Persistence is the Redis data volume spec. While enabled, Redis runs as a StatefulSet keeping its data on a
+	// PersistentVolumeClaim instead of as a Deployment.
+	// +optional
+	Persistence RedisPersistence `json:"persistence,omitempty"`
+
+	// External is an existing Redis to point podinfo at instead. While set, the operator neither creates nor deletes
+	// the Redis Deployment, StatefulSet and Services; image, resources, auth and persistence are unused.
+	// +optional
+	External *RedisExternal `json:"external,omitempty"`
+}
+
+// RedisExternal spec for a Redis endpoint not managed by the operator.
+type RedisExternal struct {
+	// Address is the host name or IP address of the Redis endpoint.
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+
+	// Port is the port of the Redis endpoint. Defaults to 6379.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// TLS is whether to connect to the endpoint over TLS.
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+
+	// SecretRef is the Secret key, in the MyAppResource's namespace, holding the Redis password. The password is
+	// embedded in podinfo's cache server URL, so it must be URL-safe. The Secret must be labelled with
+	// MyAppResourceLabelName, with any value, to be read. When unset, podinfo connects without one.
+	// +optional
+	SecretRef *SecretKeyReference `json:"secretRef,omitempty"`
+}
+
+// RedisAuth spec for the Redis password.
+type RedisAuth struct {
+	// Enable or disable Redis authentication.
+	Enabled bool `json:"enabled"`
+
+	// SecretRef is an existing Secret key, in the MyAppResource's namespace, holding the Redis password. The password
+	// is embedded in podinfo's cache server URL, so it must be URL-safe. The Secret must be labelled with
+	// MyAppResourceLabelName, with any value, to be read. When unset, the operator generates a password into an owned
+	// Secret named after the MyAppResource with the RedisAuthNameSuffix.
+	// +optional
+	SecretRef *SecretKeyReference `json:"secretRef,omitempty"`
+}
+
+// SecretKeyReference selects a key of a Secret in the MyAppResource's namespace.
+type SecretKeyReference struct {
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+
+	// Key is the key of the Secret data holding the value. Defaults to "password".
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// RedisPersistenceMode is how Redis persists its data to disk.
+// +kubebuilder:validation:Enum=AOF;RDB
+type RedisPersistenceMode string
+
+const (
+	// RedisPersistenceAOF logs every write to an append-only file.
+	RedisPersistenceAOF RedisPersistenceMode = "AOF"
+
+	// RedisPersistenceRDB periodically snapshots the dataset.
+	RedisPersistenceRDB RedisPersistenceMode = "RDB"
+)
+
+// RedisPersistence spec for the Redis data volume.
+type RedisPersistence struct {
+	// Enable or disable Redis persistence.
+	Enabled bool `json:"enabled"`
+
+	// StorageClassName is the storage class of the Redis PersistentVolumeClaim. Defaults to the cluster's default
+	// storage class.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// Size is the size of the Redis PersistentVolumeClaim. Defaults to 1Gi.
+	// +optional
+	Size resource.Quantity `json:"size,omitempty"`
+
+	// Mode is how Redis persists its data, AOF or RDB. Defaults to AOF.
+	// +optional
+	Mode RedisPersistenceMode `json:"mode,omitempty"`
+
+	// DeleteClaims is whether the Redis PersistentVolumeClaims are deleted along with the MyAppResource. Defaults to
+	// false, which keeps them, and the data on them, for a MyAppResource of the same name to run on again.
+	// +optional
+	DeleteClaims bool `json:"deleteClaims,omitempty"`
+}
+
+// Probes spec for the health probes of a container. Every probe runs with defaults suited to its container unless it
+// is tuned or disabled here.
+type Probes struct {
+	// Liveness is the probe restarting the container once it fails.
+	// +optional
+	Liveness *ProbeSettings `json:"liveness,omitempty"`
+
+	// Readiness is the probe taking the pod out of its Service while it fails.
+	// +optional
+	Readiness *ProbeSettings `json:"readiness,omitempty"`
+
+	// Startup is the probe holding the other probes off until the container has started.
+	// +optional
+	Startup *ProbeSettings `json:"startup,omitempty"`
+}
+
+// ProbeSettings tunes a health probe. Unset fields keep the probe's defaults.
+type ProbeSettings struct {
+	// Enable or disable the probe. Defaults to true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// InitialDelaySeconds is the time after the container started before the probe first runs.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// PeriodSeconds is the time between two runs of the probe.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds is the time after which a run of the probe fails.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// FailureThreshold is the number of failed runs in a row after which the probe fails.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
+
+// Ingress spec for the podinfo Ingress.
+type Ingress struct {
+	// ClassName is the name of the IngressClass implementing the Ingress. Defaults to the cluster's default
+	// IngressClass.
+	// +optional
+	ClassName *string `json:"className,omitempty"`
+
+	// Annotations are the annotations set on the Ingress, e.g. to configure its controller.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Hosts are the hosts routed to podinfo. When empty, requests for any host are.
+	// +optional
+	Hosts []IngressHost `json:"hosts,omitempty"`
+
+	// TLS is the list of certificates, each from a Secret, the Ingress terminates TLS for its hosts with.
+	// +optional
+	TLS []IngressTLS `json:"tls,omitempty"`
+}
+
+// IngressHost spec for a host routed to podinfo.
+type IngressHost struct {
+	// Host is the fully qualified domain name of the host, optionally with a leading "*." wildcard.
+	Host string `json:"host"`
+
+	// Paths are the paths of the host routed to podinfo. Defaults to "/".
+	// +optional
+	Paths []IngressPath `json:"paths,omitempty"`
+}
+
+// IngressPath spec for a path routed to podinfo.
+type IngressPath struct {
+	// Path is the path matched against the request path. Defaults to "/".
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// PathType is how Path is matched. Defaults to Prefix.
+	// +kubebuilder:validation:Enum=Exact;Prefix;ImplementationSpecific
+	// +optional
+	PathType networkingv1.PathType `json:"pathType,omitempty"`
+}
+
+// IngressTLS spec for a TLS certificate of the Ingress.
+type IngressTLS struct {
+	// Hosts are the hosts the certificate is for. Defaults to the Ingress controller's default.
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+
+	// SecretName is the name of the Secret holding the certificate, in the MyAppResource's namespace.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// Gateway spec for the podinfo Gateway API routes.
+type Gateway struct {
+	// ParentRefs are the Gateways, or Gateway listeners, the routes attach to.
+	// +kubebuilder:validation:MinItems=1
+	ParentRefs []gatewayv1.ParentReference `json:"parentRefs"`
+
+	// Hostnames are the hostnames the routes match. When empty, the hostnames of the Gateway listeners are matched.
+	// +optional
+	Hostnames []gatewayv1.Hostname `json:"hostnames,omitempty"`
+
+	// GRPC is whether gRPC requests are also routed to the podinfo grpc port, through a GRPCRoute. GRPCRoute is part
+	// of the Gateway API experimental channel.
+	// +optional
+	GRPC bool `json:"grpc,omitempty"`
+}
+
+// MonitoringKind is the Prometheus operator resource scraping podinfo.
+// +kubebuilder:validation:Enum=ServiceMonitor;PodMonitor
+type MonitoringKind string
+
+const (
+	// MonitoringServiceMonitor scrapes podinfo through the metrics port of its Service.
+	MonitoringServiceMonitor MonitoringKind = "ServiceMonitor"
+
+	// MonitoringPodMonitor scrapes the podinfo pods directly.
+	MonitoringPodMonitor MonitoringKind = "PodMonitor"
+)
+
+// Monitoring spec for the podinfo metrics. The monitor is only created while the Prometheus operator CRDs are
+// installed.
+type Monitoring struct {
+	// Enable or disable scraping podinfo. While enabled, the podinfo Service also exposes the http-metrics port.
+	Enabled bool `json:"enabled"`
+
+	// Kind is the kind of the monitor, ServiceMonitor or PodMonitor. Defaults to ServiceMonitor.
+	// +optional
+	Kind MonitoringKind `json:"kind,omitempty"`
+
+	// Interval is the time between scrapes. Defaults to the Prometheus global scrape interval.
+	// +optional
+	Interval monitoringv1.Duration `json:"interval,omitempty"`
+
+	// ScrapeTimeout is the timeout of a scrape. Defaults to the Prometheus global scrape timeout.
+	// +optional
+	ScrapeTimeout monitoringv1.Duration `json:"scrapeTimeout,omitempty"`
+
+	// Labels are the labels set on the monitor, e.g. to match the monitor selector of a Prometheus.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Alerting spec for the default podinfo alerts: podinfo unavailable, a high rate of 5xx responses, Redis down and
+// fewer available replicas than desired. The PrometheusRule is only created while the Prometheus operator CRDs are
+// installed.
+type Alerting struct {
+	// Enable or disable the podinfo alerts. The error rate alert relies on podinfo being scraped, see monitoring; the
+	// others on kube-state-metrics.
+	Enabled bool `json:"enabled"`
+
+	// ErrorRatePercent is the share of podinfo requests answered with a 5xx above which PodinfoHighErrorRate fires.
+	// Defaults to 5.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	ErrorRatePercent *int32 `json:"errorRatePercent,omitempty"`
+
+	// For is how long a condition must hold before its alert fires. Defaults to 5m.
+	// +optional
+	For monitoringv1.Duration `json:"for,omitempty"`
+
+	// Labels are the labels set on the PrometheusRule, e.g. to match the rule selector of a Prometheus.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Disruption spec for the podinfo PodDisruptionBudget. At most one of minAvailable and maxUnavailable may be set;
+// when neither is, maxUnavailable defaults to 1.
+type Disruption struct {
+	// MinAvailable is the number, or percentage, of podinfo pods that must stay available during a disruption.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number, or percentage, of podinfo pods that may be unavailable during a disruption.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// NetworkPolicy spec for the podinfo and Redis NetworkPolicies. Redis only admits this app's podinfo pods, on the
+// Redis port. podinfo admits the from peers on its http and grpc ports and, while monitoring, any peer on its metrics
+// port.
+type NetworkPolicy struct {
+	// Enable or disable the NetworkPolicies. Defaults to true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// From is the list of namespace or pod selectors admitted to the podinfo http and grpc ports, e.g. that of the
+	// ingress controller's namespace. Every peer is admitted when empty.
+	// +optional
+	From []networkingv1.NetworkPolicyPeer `json:"from,omitempty"`
+}
+
+// Autoscaling spec for the podinfo HorizontalPodAutoscaler.
+type Autoscaling struct {
+	// Enable or disable autoscaling of the podinfo deployment.
+	Enabled bool `json:"enabled"`
+
+	// MinReplicas is the lower limit for the number of podinfo replicas. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the upper limit for the number of podinfo replicas. Required when autoscaling is enabled.
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+
+	// TargetCPUUtilizationPercentage is the target average CPU utilization, relative to the CPU request. Defaults to
+	// 80 when no target is set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// TargetMemoryUtilizationPercentage is the target average memory utilization, relative to the memory request.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// Behavior is the scaling behavior in both the up and down directions.
+	// +optional
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
 }
 
 type Image struct {
@@ -69,6 +479,11 @@ type Image struct {
 
 	// Tag is the image version to pull
 	Tag string `json:"tag"`
+
+	// PullPolicy is the image pull policy. Defaults to Always for the latest tag and IfNotPresent otherwise.
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
 }
 
 type Resources struct {
@@ -76,18 +491,53 @@ type Resources struct {
 	// +optional
 	MemoryLimit resource.Quantity `json:"memoryLimit,omitempty"`
 
-	// memoryLimit is the mem limit for a myappresource dpod.
-	CPURequest resource.Quantity `json:"cpuRequest"`
+	// memoryRequest is the mem request for a myappresource pod. It may not exceed memoryLimit.
+	// +optional
+	MemoryRequest resource.Quantity `json:"memoryRequest,omitempty"`
+
+	// cpuRequest is the cpu request for a myappresource pod.
+	// +optional
+	CPURequest resource.Quantity `json:"cpuRequest,omitempty"`
 }
 
 // MyAppResourceStatus defines the observed state of MyAppResource
 type MyAppResourceStatus struct {
-	// ready indicates whether the podinfo deployment's ready replicas is equal to it's requested replicas.
+	// ready mirrors the Ready condition for clients that only need a boolean.
+	// +optional
 	Ready bool `json:"ready"`
+
+	// replicas is the number of podinfo pods targeted by the podinfo deployment, for the scale subresource.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// selector is the label selector of the podinfo pods, for the scale subresource.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// image is the podinfo image the podinfo deployment runs.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// observedGeneration is the metadata.generation last acted upon by the operator.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// conditions describe the current state of the podinfo application and its Redis cache.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:subresource:scale:specpath=.spec.replicaCount,statuspath=.status.replicas,selectorpath=.status.selector
+//+kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
+//+kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.status.replicas`
+//+kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.status.image`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // MyAppResource is the Schema for the myappresources API
 type MyAppResource struct {
@@ -0,0 +1,544 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// RedisNameSuffix is appended to the MyAppResource name to name its Redis Deployment or StatefulSet, and Service.
+const RedisNameSuffix = "-redis"
+
+// RedisAuthNameSuffix is appended to the MyAppResource name to name the Secret of a generated Redis password.
+const RedisAuthNameSuffix = RedisNameSuffix + "-auth"
+
+// DefaultSecretKey is the Secret key read when a SecretKeyReference does not name one.
+const DefaultSecretKey = "password"
+
+// RedisHeadlessNameSuffix is appended to the MyAppResource name to name the headless Service of a persistent Redis.
+const RedisHeadlessNameSuffix = RedisNameSuffix + "-headless"
+
+// DefaultImageRepository is the podinfo image repository used when spec.image.repository is empty.
+const DefaultImageRepository = "ghcr.io/stefanprodan/podinfo"
+
+// DefaultRedisImage is the Redis image run when spec.redis.image is not set.
+var DefaultRedisImage = Image{Repository: "redis", Tag: "7.2.4-alpine3.19"}
+
+// DefaultRedisPort is the port of an external Redis when spec.redis.external.port is not set.
+const DefaultRedisPort = int32(6379)
+
+// DefaultMaxUnavailable is the maxUnavailable of the podinfo PodDisruptionBudget when spec.disruption sets neither
+// minAvailable nor maxUnavailable.
+var DefaultMaxUnavailable = intstr.FromInt32(1)
+
+// defaultTargetCPUUtilizationPercentage is the autoscaling target used when no target is set, as in the
+// HorizontalPodAutoscaler itself.
+const defaultTargetCPUUtilizationPercentage = int32(80)
+
+// Alerting defaults, used when spec.alerting does not set a threshold.
+const (
+	defaultAlertErrorRatePercent = int32(5)
+	defaultAlertFor              = monitoringv1.Duration("5m")
+)
+
+// defaultRedisPersistenceSize is the size of the Redis PersistentVolumeClaim when none is set.
+var defaultRedisPersistenceSize = resource.MustParse("1Gi")
+
+// Resource defaults for the podinfo and Redis containers.
+var (
+	defaultResources = Resources{
+		CPURequest:    resource.MustParse("100m"),
+		MemoryRequest: resource.MustParse("64Mi"),
+		MemoryLimit:   resource.MustParse("128Mi"),
+	}
+	defaultRedisResources = Resources{
+		CPURequest:    resource.MustParse("50m"),
+		MemoryRequest: resource.MustParse("32Mi"),
+		MemoryLimit:   resource.MustParse("64Mi"),
+	}
+)
+
+var (
+	// log is for logging in this package.
+	myappresourcelog = logf.Log.WithName("myappresource-resource")
+
+	// hexColorRegexp matches #rgb, #rgba, #rrggbb and #rrggbbaa colors.
+	hexColorRegexp = regexp.MustCompile(`^#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+	// imageTagRegexp is the tag grammar of a container image reference.
+	imageTagRegexp = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+	// imageRepositoryRegexp is the [domain[:port]/]path grammar of a container image reference.
+	imageRepositoryRegexp = regexp.MustCompile(
+		`^(?:(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*` +
+			`(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*)*$`)
+)
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *MyAppResource) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-podinfo-podinfo-com-v1alpha1-myappresource,mutating=true,failurePolicy=fail,sideEffects=None,groups=podinfo.podinfo.com,resources=myappresources,verbs=create;update,versions=v1alpha1,name=mmyappresource.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &MyAppResource{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *MyAppResource) Default() {
+	myappresourcelog.Info("default", "name", r.Name)
+
+	if r.Spec.ReplicaCount == nil {
+		r.Spec.ReplicaCount = ptr.To(int32(1))
+	}
+	if r.Spec.Image.Repository == "" {
+		r.Spec.Image.Repository = DefaultImageRepository
+	}
+	defaultResources.defaultInto(&r.Spec.Resources)
+
+	if r.Spec.Autoscaling.Enabled {
+		if r.Spec.Autoscaling.MinReplicas == nil {
+			r.Spec.Autoscaling.MinReplicas = ptr.To(int32(1))
+		}
+		if r.Spec.Autoscaling.TargetCPUUtilizationPercentage == nil &&
+			r.Spec.Autoscaling.TargetMemoryUtilizationPercentage == nil {
+			r.Spec.Autoscaling.TargetCPUUtilizationPercentage = ptr.To(defaultTargetCPUUtilizationPercentage)
+		}
+	}
+
+	if r.Spec.Ingress != nil {
+		r.Spec.Ingress.defaultPaths()
+	}
+	if r.Spec.Monitoring.Enabled && r.Spec.Monitoring.Kind == "" {
+		r.Spec.Monitoring.Kind = MonitoringServiceMonitor
+	}
+	if alerting := &r.Spec.Alerting; alerting.Enabled {
+		if alerting.ErrorRatePercent == nil {
+			alerting.ErrorRatePercent = ptr.To(defaultAlertErrorRatePercent)
+		}
+		if alerting.For == "" {
+			alerting.For = defaultAlertFor
+		}
+	}
+
+	if external := r.Spec.Redis.External; r.Spec.Redis.Enabled && external != nil {
+		if external.Port == 0 {
+			external.Port = DefaultRedisPort
+		}
+		if external.SecretRef != nil && external.SecretRef.Key == "" {
+			external.SecretRef.Key = DefaultSecretKey
+		}
+	}
+
+	// Redis defaults are only filled in while the operator runs Redis, and again once it does.
+	if r.Spec.Redis.Enabled && r.Spec.Redis.External == nil {
+		if r.Spec.Redis.Image == nil {
+			redisImage := DefaultRedisImage
+			r.Spec.Redis.Image = &redisImage
+		}
+		defaultRedisResources.defaultInto(&r.Spec.Redis.Resources)
+
+		if secretRef := r.Spec.Redis.Auth.SecretRef; r.Spec.Redis.Auth.Enabled && secretRef != nil && secretRef.Key == "" {
+			secretRef.Key = DefaultSecretKey
+		}
+
+		if persistence := &r.Spec.Redis.Persistence; persistence.Enabled {
+			if persistence.Size.IsZero() {
+				persistence.Size = defaultRedisPersistenceSize.DeepCopy()
+			}
+			if persistence.Mode == "" {
+				persistence.Mode = RedisPersistenceAOF
+			}
+		}
+	}
+}
+
+// defaultPaths routes "/" of every host without paths, and matches paths by prefix unless set otherwise.
+func (i *Ingress) defaultPaths() {
+	for h := range i.Hosts {
+		host := &i.Hosts[h]
+		if len(host.Paths) == 0 {
+			host.Paths = []IngressPath{{}}
+		}
+		for p := range host.Paths {
+			if host.Paths[p].Path == "" {
+				host.Paths[p].Path = "/"
+			}
+			if host.Paths[p].PathType == "" {
+				host.Paths[p].PathType = networkingv1.PathTypePrefix
+			}
+		}
+	}
+}
+
+// defaultInto fills every unset quantity of resources from d. A defaulted memory request never exceeds a memory limit
+// the user set, and a defaulted memory limit never falls below a memory request the user set.
+func (d Resources) defaultInto(resources *Resources) {
+	if resources.CPURequest.IsZero() {
+		resources.CPURequest = d.CPURequest.DeepCopy()
+	}
+	switch {
+	case resources.MemoryRequest.IsZero() && resources.MemoryLimit.IsZero():
+		resources.MemoryRequest = d.MemoryRequest.DeepCopy()
+		resources.MemoryLimit = d.MemoryLimit.DeepCopy()
+	case resources.MemoryRequest.IsZero():
+		resources.MemoryRequest = d.MemoryRequest.DeepCopy()
+		if resources.MemoryLimit.Cmp(resources.MemoryRequest) < 0 {
+			resources.MemoryRequest = resources.MemoryLimit.DeepCopy()
+		}
+	case resources.MemoryLimit.IsZero():
+		resources.MemoryLimit = d.MemoryLimit.DeepCopy()
+		if resources.MemoryLimit.Cmp(resources.MemoryRequest) < 0 {
+			resources.MemoryLimit = resources.MemoryRequest.DeepCopy()
+		}
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-podinfo-podinfo-com-v1alpha1-myappresource,mutating=false,failurePolicy=fail,sideEffects=None,groups=podinfo.podinfo.com,resources=myappresources,verbs=create;update,versions=v1alpha1,name=vmyappresource.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &MyAppResource{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *MyAppResource) ValidateCreate() (admission.Warnings, error) {
+	myappresourcelog.Info("validate create", "name", r.Name)
+	return nil, r.toInvalidError(r.validateMyAppResource())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *MyAppResource) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	myappresourcelog.Info("validate update", "name", r.Name)
+	oldMyApp := old.(*MyAppResource)
+
+	// Updates that leave the spec alone (labels, finalizers...) are always let through, so objects stored before a
+	// validation rule existed can still be managed and deleted.
+	if equality.Semantic.DeepEqual(oldMyApp.Spec, r.Spec) {
+		return nil, nil
+	}
+
+	allErrs := r.validateMyAppResource()
+	allErrs = append(allErrs, r.validateOrphaningChanges(oldMyApp)...)
+	allErrs = append(allErrs, r.validateImmutableChanges(oldMyApp)...)
+	return nil, r.toInvalidError(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *MyAppResource) ValidateDelete() (admission.Warnings, error) {
+	// Deletes are not validated; no webhook is registered for them.
+	return nil, nil
+}
+
+// toInvalidError wraps the field errors into a field-path-aware Invalid status error, or returns nil if there are none.
+func (r *MyAppResource) toInvalidError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "MyAppResource"}, r.Name, allErrs)
+}
+
+// validateMyAppResource validates the name and spec of a MyAppResource.
+func (r *MyAppResource) validateMyAppResource() field.ErrorList {
+	allErrs := r.validateName()
+	specPath := field.NewPath("spec")
+
+	if r.Spec.ReplicaCount != nil {
+		allErrs = append(allErrs,
+			apivalidation.ValidateNonnegativeField(int64(*r.Spec.ReplicaCount), specPath.Child("replicaCount"))...)
+	}
+	allErrs = append(allErrs, validateImage(r.Spec.Image, specPath.Child("image"))...)
+	if r.Spec.Redis.Image != nil {
+		allErrs = append(allErrs, validateImage(*r.Spec.Redis.Image, specPath.Child("redis", "image"))...)
+	}
+	allErrs = append(allErrs, validateColor(r.Spec.UI.Color, specPath.Child("ui", "color"))...)
+	allErrs = append(allErrs, validateResources(r.Spec.Resources, specPath.Child("resources"))...)
+	allErrs = append(allErrs, validateResources(r.Spec.Redis.Resources, specPath.Child("redis", "resources"))...)
+	allErrs = append(allErrs, validateAutoscaling(r.Spec.Autoscaling, specPath.Child("autoscaling"))...)
+	allErrs = append(allErrs, validateDisruption(r.Spec.Disruption, specPath.Child("disruption"))...)
+	if r.Spec.Redis.Auth.SecretRef != nil {
+		allErrs = append(allErrs,
+			validateSecretKeyReference(*r.Spec.Redis.Auth.SecretRef, specPath.Child("redis", "auth", "secretRef"))...)
+	}
+	if r.Spec.Redis.External != nil {
+		allErrs = append(allErrs, validateRedisExternal(r.Spec.Redis, specPath.Child("redis"))...)
+	}
+	if r.Spec.Ingress != nil {
+		allErrs = append(allErrs, validateIngress(*r.Spec.Ingress, specPath.Child("ingress"))...)
+	}
+	return allErrs
+}
+
+// validateName checks that the name fits every child resource named after it. The podinfo and Redis Services all
+// need a DNS-1035 label name, the Redis ones with the RedisNameSuffix or RedisHeadlessNameSuffix appended.
+func (r *MyAppResource) validateName() field.ErrorList {
+	allErrs := field.ErrorList{}
+	namePath := field.NewPath("metadata", "name")
+	for _, msg := range validation.IsDNS1035Label(r.Name) {
+		allErrs = append(allErrs, field.Invalid(namePath, r.Name, msg))
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+	suffixes := []string{RedisNameSuffix}
+	if r.Spec.Redis.Enabled && r.Spec.Redis.External == nil && r.Spec.Redis.Persistence.Enabled {
+		suffixes = append(suffixes, RedisHeadlessNameSuffix)
+	}
+	for _, suffix := range suffixes {
+		for _, msg := range validation.IsDNS1035Label(r.Name + suffix) {
+			allErrs = append(allErrs, field.Invalid(namePath, r.Name, "with the \""+suffix+"\" suffix: "+msg))
+		}
+	}
+	return allErrs
+}
+
+// validateOrphaningChanges rejects spec changes that would leave child resources behind.
+func (r *MyAppResource) validateOrphaningChanges(old *MyAppResource) field.ErrorList {
+	allErrs := field.ErrorList{}
+	// Children already torn down during deletion would not be recreated from, nor cleaned up after, a new spec.
+	if old.GetDeletionTimestamp() != nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"),
+			"may not be changed while the myappresource is being deleted"))
+	}
+	// Pointing podinfo at an external Redis while the operator's own still runs would leave the latter running unused,
+	// as the operator neither updates nor deletes it then; it has to be disabled, and so deleted, first.
+	if old.Spec.Redis.Enabled && old.Spec.Redis.External == nil && r.Spec.Redis.Enabled && r.Spec.Redis.External != nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "redis", "external"),
+			"may not be set while the operator runs redis; disable redis first"))
+	}
+	return allErrs
+}
+
+// validateImmutableChanges rejects changes to fields the children cannot change in place.
+func (r *MyAppResource) validateImmutableChanges(old *MyAppResource) field.ErrorList {
+	allErrs := field.ErrorList{}
+	oldPersistence, persistence := old.Spec.Redis.Persistence, r.Spec.Redis.Persistence
+	if !oldPersistence.Enabled || !persistence.Enabled {
+		return allErrs
+	}
+	// The volume claim template of a StatefulSet is immutable.
+	persistencePath := field.NewPath("spec", "redis", "persistence")
+	if !equality.Semantic.DeepEqual(oldPersistence.StorageClassName, persistence.StorageClassName) {
+		allErrs = append(allErrs, field.Forbidden(persistencePath.Child("storageClassName"),
+			"may not be changed while persistence is enabled"))
+	}
+	if oldPersistence.Size.Cmp(persistence.Size) != 0 {
+		allErrs = append(allErrs, field.Forbidden(persistencePath.Child("size"),
+			"may not be changed while persistence is enabled"))
+	}
+	return allErrs
+}
+
+// validateImage checks that the image repository and tag form a valid image reference.
+func validateImage(image Image, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if image.Repository != "" && !imageRepositoryRegexp.MatchString(image.Repository) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("repository"), image.Repository,
+			"must be a valid image repository, e.g. ghcr.io/stefanprodan/podinfo"))
+	}
+	if image.Tag == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("tag"), ""))
+	} else if !imageTagRegexp.MatchString(image.Tag) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("tag"), image.Tag,
+			"must be a valid image tag of at most 128 word characters, '.' or '-', not starting with '.' or '-'"))
+	}
+	return allErrs
+}
+
+// validateColor checks that color is either empty, a hex color or a CSS named color.
+func validateColor(color string, fldPath *field.Path) field.ErrorList {
+	if color == "" || hexColorRegexp.MatchString(color) || cssNamedColors.Has(strings.ToLower(color)) {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(fldPath, color, "must be a hex color such as #34577c or a CSS color name")}
+}
+
+// validateResources checks that the memory limit is not below the memory request.
+func validateResources(resources Resources, fldPath *field.Path) field.ErrorList {
+	if resources.MemoryLimit.IsZero() || resources.MemoryRequest.IsZero() {
+		return nil
+	}
+	if resources.MemoryLimit.Cmp(resources.MemoryRequest) < 0 {
+		return field.ErrorList{field.Invalid(fldPath.Child("memoryLimit"), resources.MemoryLimit.String(),
+			"must be greater than or equal to memoryRequest "+resources.MemoryRequest.String())}
+	}
+	return nil
+}
+
+// validateAutoscaling checks that enabled autoscaling has a replica range to scale within.
+func validateAutoscaling(autoscaling Autoscaling, fldPath *field.Path) field.ErrorList {
+	if !autoscaling.Enabled {
+		return nil
+	}
+	allErrs := field.ErrorList{}
+	if autoscaling.MaxReplicas < 1 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("maxReplicas"),
+			"must be at least 1 when autoscaling is enabled"))
+	} else if autoscaling.MinReplicas != nil && *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxReplicas"), autoscaling.MaxReplicas,
+			"must be greater than or equal to minReplicas"))
+	}
+	return allErrs
+}
+
+// validateDisruption checks that at most one of minAvailable and maxUnavailable is set, as in the
+// PodDisruptionBudget itself, and that each is a non-negative number or a percentage of at most 100%.
+func validateDisruption(disruption Disruption, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if disruption.MinAvailable != nil && disruption.MaxUnavailable != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("maxUnavailable"),
+			"may not be set together with minAvailable"))
+	}
+	allErrs = append(allErrs, validateIntOrPercent(disruption.MinAvailable, fldPath.Child("minAvailable"))...)
+	allErrs = append(allErrs, validateIntOrPercent(disruption.MaxUnavailable, fldPath.Child("maxUnavailable"))...)
+	return allErrs
+}
+
+// validateIntOrPercent checks that value, when set, is a non-negative number or a percentage between 0% and 100%.
+func validateIntOrPercent(value *intstr.IntOrString, fldPath *field.Path) field.ErrorList {
+	if value == nil {
+		return nil
+	}
+	if value.Type == intstr.Int {
+		return apivalidation.ValidateNonnegativeField(int64(value.IntVal), fldPath)
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%"))
+	if !strings.HasSuffix(value.StrVal, "%") || err != nil || percent < 0 || percent > 100 {
+		return field.ErrorList{field.Invalid(fldPath, value.StrVal,
+			"must be a number or a percentage between 0% and 100%")}
+	}
+	return nil
+}
+
+// validateSecretKeyReference checks that ref names a valid Secret and key.
+func validateSecretKeyReference(ref SecretKeyReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("name"), ref.Name, msg))
+	}
+	if ref.Key != "" {
+		for _, msg := range validation.IsConfigMapKey(ref.Key) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("key"), ref.Key, msg))
+		}
+	}
+	return allErrs
+}
+
+// validateRedisExternal checks that an external Redis has a valid address, and that options only the operator's own
+// Redis can honor are not enabled alongside it.
+func validateRedisExternal(redis Redis, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	externalPath := fldPath.Child("external")
+	address := redis.External.Address
+	if net.ParseIP(address) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(address) {
+			allErrs = append(allErrs, field.Invalid(externalPath.Child("address"), address,
+				"must be an IP address or a host name: "+msg))
+		}
+	}
+	if redis.External.SecretRef != nil {
+		allErrs = append(allErrs,
+			validateSecretKeyReference(*redis.External.SecretRef, externalPath.Child("secretRef"))...)
+	}
+	if redis.Auth.Enabled {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("auth", "enabled"),
+			"may not be set with an external redis, use external.secretRef instead"))
+	}
+	if redis.Persistence.Enabled {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("persistence", "enabled"),
+			"may not be set with an external redis"))
+	}
+	return allErrs
+}
+
+// validateIngress checks that the Ingress hosts are valid domain names, its paths absolute, and its TLS Secret names
+// valid.
+func validateIngress(ingress Ingress, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	validateHost := func(host string, hostPath *field.Path) {
+		msgs := validation.IsDNS1123Subdomain(host)
+		if strings.HasPrefix(host, "*.") {
+			msgs = validation.IsWildcardDNS1123Subdomain(host)
+		}
+		for _, msg := range msgs {
+			allErrs = append(allErrs, field.Invalid(hostPath, host, msg))
+		}
+	}
+	for i, host := range ingress.Hosts {
+		hostPath := fldPath.Child("hosts").Index(i)
+		validateHost(host.Host, hostPath.Child("host"))
+		for j, path := range host.Paths {
+			if path.Path != "" && !strings.HasPrefix(path.Path, "/") {
+				allErrs = append(allErrs, field.Invalid(hostPath.Child("paths").Index(j).Child("path"), path.Path,
+					"must be an absolute path"))
+			}
+		}
+	}
+	for i, tls := range ingress.TLS {
+		tlsPath := fldPath.Child("tls").Index(i)
+		for j, host := range tls.Hosts {
+			validateHost(host, tlsPath.Child("hosts").Index(j))
+		}
+		if tls.SecretName != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(tls.SecretName) {
+				allErrs = append(allErrs, field.Invalid(tlsPath.Child("secretName"), tls.SecretName, msg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// cssNamedColors are the CSS Color Module Level 4 named colors, plus transparent.
+var cssNamedColors = sets.New(
+	"aliceblue", "antiquewhite", "aqua", "aquamarine", "azure", "beige", "bisque", "black", "blanchedalmond", "blue",
+	"blueviolet", "brown", "burlywood", "cadetblue", "chartreuse", "chocolate", "coral", "cornflowerblue", "cornsilk",
+	"crimson", "cyan", "darkblue", "darkcyan", "darkgoldenrod", "darkgray", "darkgreen", "darkgrey", "darkkhaki",
+	"darkmagenta", "darkolivegreen", "darkorange", "darkorchid", "darkred", "darksalmon", "darkseagreen",
+	"darkslateblue", "darkslategray", "darkslategrey", "darkturquoise", "darkviolet", "deeppink", "deepskyblue",
+	"dimgray", "dimgrey", "dodgerblue", "firebrick", "floralwhite", "forestgreen", "fuchsia", "gainsboro",
+	"ghostwhite", "gold", "goldenrod", "gray", "green", "greenyellow", "grey", "honeydew", "hotpink", "indianred",
+	"indigo", "ivory", "khaki", "lavender", "lavenderblush", "lawngreen", "lemonchiffon", "lightblue", "lightcoral",
+	"lightcyan", "lightgoldenrodyellow", "lightgray", "lightgreen", "lightgrey", "lightpink", "lightsalmon",
+	"lightseagreen", "lightskyblue", "lightslategray", "lightslategrey", "lightsteelblue", "lightyellow", "lime",
+	"limegreen", "linen", "magenta", "maroon", "mediumaquamarine", "mediumblue", "mediumorchid", "mediumpurple",
+	"mediumseagreen", "mediumslateblue", "mediumspringgreen", "mediumturquoise", "mediumvioletred", "midnightblue",
+	"mintcream", "mistyrose", "moccasin", "navajowhite", "navy", "oldlace", "olive", "olivedrab", "orange",
+	"orangered", "orchid", "palegoldenrod", "palegreen", "paleturquoise", "palevioletred", "papayawhip", "peachpuff",
+	"peru", "pink", "plum", "powderblue", "purple", "rebeccapurple", "red", "rosybrown", "royalblue", "saddlebrown",
+	"salmon", "sandybrown", "seagreen", "seashell", "sienna", "silver", "skyblue", "slateblue", "slategray",
+	"slategrey", "snow", "springgreen", "steelblue", "tan", "teal", "thistle", "tomato", "transparent", "turquoise",
+	"violet", "wheat", "white", "whitesmoke", "yellow", "yellowgreen",
+)
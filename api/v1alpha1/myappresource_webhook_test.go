@@ -0,0 +1,338 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// expectInvalid asserts err is an Invalid response naming the given field. Errors from the API server's own CRD
+// validation, such as the scale subresource's replica check, report the field with a leading dot.
+func expectInvalid(err error, field string) {
+	ExpectWithOffset(1, apierrors.IsInvalid(err)).To(BeTrue(), "expected an invalid error, got %v", err)
+	causes := err.(apierrors.APIStatus).Status().Details.Causes
+	ExpectWithOffset(1, causes).To(ContainElement(HaveField("Field", BeElementOf(field, "."+field))))
+}
+
+var _ = Describe("MyAppResource Webhook", func() {
+	var myappresource *MyAppResource
+
+	BeforeEach(func() {
+		myappresource = &MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook-resource", Namespace: "default"},
+			Spec: MyAppResourceSpec{
+				ReplicaCount: ptr.To(int32(2)),
+				Image:        Image{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.5.4"},
+				UI:           UI{Color: "#34577c", Message: "some string"},
+				Resources: Resources{
+					CPURequest:    resource.MustParse("100m"),
+					MemoryRequest: resource.MustParse("32Mi"),
+					MemoryLimit:   resource.MustParse("64Mi"),
+				},
+				Redis: Redis{Enabled: true},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		_ = k8sClient.Delete(ctx, myappresource)
+	})
+
+	Context("When creating MyAppResource under Defaulting Webhook", func() {
+		It("Should fill in the defaults of a minimal myappresource", func() {
+			myappresource.Spec = MyAppResourceSpec{Image: Image{Tag: "6.5.4"}, Redis: Redis{Enabled: true}}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(myappresource.Spec.ReplicaCount).To(Equal(ptr.To(int32(1))))
+			Expect(myappresource.Spec.Image.Repository).To(Equal(DefaultImageRepository))
+			Expect(myappresource.Spec.Resources.CPURequest.String()).To(Equal("100m"))
+			Expect(myappresource.Spec.Resources.MemoryRequest.String()).To(Equal("64Mi"))
+			Expect(myappresource.Spec.Resources.MemoryLimit.String()).To(Equal("128Mi"))
+			Expect(myappresource.Spec.Redis.Image).To(Equal(&DefaultRedisImage))
+			Expect(myappresource.Spec.Redis.Resources.CPURequest.String()).To(Equal("50m"))
+			Expect(myappresource.Spec.Redis.Resources.MemoryLimit.String()).To(Equal("64Mi"))
+		})
+
+		It("Should default the autoscaling range and target", func() {
+			myappresource.Spec.Autoscaling = Autoscaling{Enabled: true, MaxReplicas: 5}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(myappresource.Spec.Autoscaling.MinReplicas).To(Equal(ptr.To(int32(1))))
+			Expect(myappresource.Spec.Autoscaling.TargetCPUUtilizationPercentage).To(Equal(ptr.To(int32(80))))
+		})
+
+		It("Should default redis persistence", func() {
+			myappresource.Spec.Redis.Persistence = RedisPersistence{Enabled: true}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(myappresource.Spec.Redis.Persistence.Size.String()).To(Equal("1Gi"))
+			Expect(myappresource.Spec.Redis.Persistence.Mode).To(Equal(RedisPersistenceAOF))
+		})
+
+		It("Should default the redis auth secret key", func() {
+			myappresource.Spec.Redis.Auth = RedisAuth{Enabled: true, SecretRef: &SecretKeyReference{Name: "redis"}}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(myappresource.Spec.Redis.Auth.SecretRef.Key).To(Equal(DefaultSecretKey))
+		})
+
+		It("Should default an external redis and skip the in-cluster redis defaults", func() {
+			myappresource.Spec.Redis.External = &RedisExternal{
+				Address:   "cache.example.com",
+				SecretRef: &SecretKeyReference{Name: "managed-redis"},
+			}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(myappresource.Spec.Redis.External.Port).To(Equal(DefaultRedisPort))
+			Expect(myappresource.Spec.Redis.External.SecretRef.Key).To(Equal(DefaultSecretKey))
+			Expect(myappresource.Spec.Redis.Image).To(BeNil())
+		})
+
+		It("Should default the ingress paths", func() {
+			myappresource.Spec.Ingress = &Ingress{Hosts: []IngressHost{
+				{Host: "podinfo.example.com"},
+				{Host: "api.example.com", Paths: []IngressPath{{Path: "/api", PathType: networkingv1.PathTypeExact}}},
+			}}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(myappresource.Spec.Ingress.Hosts[0].Paths).To(Equal(
+				[]IngressPath{{Path: "/", PathType: networkingv1.PathTypePrefix}}))
+			Expect(myappresource.Spec.Ingress.Hosts[1].Paths).To(Equal(
+				[]IngressPath{{Path: "/api", PathType: networkingv1.PathTypeExact}}))
+		})
+
+		It("Should default the monitoring kind", func() {
+			myappresource.Spec.Monitoring = Monitoring{Enabled: true}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(myappresource.Spec.Monitoring.Kind).To(Equal(MonitoringServiceMonitor))
+		})
+
+		It("Should default the alerting thresholds", func() {
+			myappresource.Spec.Alerting = Alerting{Enabled: true}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(*myappresource.Spec.Alerting.ErrorRatePercent).To(Equal(defaultAlertErrorRatePercent))
+			Expect(myappresource.Spec.Alerting.For).To(Equal(defaultAlertFor))
+		})
+
+		It("Should leave the disruption budget unset, so minAvailable can be set later", func() {
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+			Expect(myappresource.Spec.Disruption.MinAvailable).To(BeNil())
+			Expect(myappresource.Spec.Disruption.MaxUnavailable).To(BeNil())
+
+			myappresource.Spec.Disruption.MinAvailable = ptr.To(intstr.FromInt32(1))
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+		})
+
+		It("Should keep values that are set and stay within them", func() {
+			myappresource.Spec.ReplicaCount = ptr.To(int32(0))
+			myappresource.Spec.Resources = Resources{MemoryLimit: resource.MustParse("32Mi")}
+			myappresource.Spec.Redis = Redis{Enabled: false}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			Expect(myappresource.Spec.ReplicaCount).To(Equal(ptr.To(int32(0))))
+			Expect(myappresource.Spec.Resources.MemoryLimit.String()).To(Equal("32Mi"))
+			Expect(myappresource.Spec.Resources.MemoryRequest.String()).To(Equal("32Mi"))
+			Expect(myappresource.Spec.Redis.Image).To(BeNil())
+			Expect(myappresource.Spec.Redis.Resources.CPURequest.IsZero()).To(BeTrue())
+			Expect(myappresource.Spec.Redis.Resources.MemoryLimit.IsZero()).To(BeTrue())
+		})
+	})
+
+	Context("When creating MyAppResource under Validating Webhook", func() {
+		It("Should admit a valid myappresource", func() {
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+		})
+
+		It("Should admit CSS color names", func() {
+			myappresource.Spec.UI.Color = "RebeccaPurple"
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+		})
+
+		It("Should deny an invalid UI color", func() {
+			myappresource.Spec.UI.Color = "#12345"
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.ui.color")
+
+			myappresource.Spec.UI.Color = "not-a-color"
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.ui.color")
+		})
+
+		It("Should deny an invalid image reference", func() {
+			myappresource.Spec.Image.Tag = "-latest"
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.image.tag")
+
+			myappresource.Spec.Image.Tag = "latest"
+			myappresource.Spec.Image.Repository = "GHCR.io/Stefanprodan/Podinfo"
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.image.repository")
+		})
+
+		It("Should deny an invalid redis auth secret reference", func() {
+			myappresource.Spec.Redis.Auth = RedisAuth{Enabled: true, SecretRef: &SecretKeyReference{Name: "Redis_Auth"}}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.redis.auth.secretRef.name")
+		})
+
+		It("Should deny an invalid external redis", func() {
+			myappresource.Spec.Redis.External = &RedisExternal{Address: "cache_server"}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.redis.external.address")
+
+			myappresource.Spec.Redis.External.Address = "cache.example.com"
+			myappresource.Spec.Redis.Auth.Enabled = true
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.redis.auth.enabled")
+		})
+
+		It("Should deny an invalid ingress", func() {
+			myappresource.Spec.Ingress = &Ingress{Hosts: []IngressHost{{Host: "Podinfo_Example"}}}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.ingress.hosts[0].host")
+
+			myappresource.Spec.Ingress = &Ingress{Hosts: []IngressHost{
+				{Host: "*.example.com", Paths: []IngressPath{{Path: "api"}}},
+			}}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.ingress.hosts[0].paths[0].path")
+		})
+
+		It("Should deny a gateway without parents", func() {
+			myappresource.Spec.Gateway = &Gateway{Hostnames: []gatewayv1.Hostname{"podinfo.example.com"}}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.gateway.parentRefs")
+		})
+
+		It("Should deny an invalid disruption budget", func() {
+			myappresource.Spec.Disruption = Disruption{MinAvailable: ptr.To(intstr.FromString("150%"))}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.disruption.minAvailable")
+
+			myappresource.Spec.Disruption = Disruption{
+				MinAvailable:   ptr.To(intstr.FromInt32(1)),
+				MaxUnavailable: ptr.To(intstr.FromInt32(1)),
+			}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.disruption.maxUnavailable")
+		})
+
+		It("Should deny a negative replica count", func() {
+			myappresource.Spec.ReplicaCount = ptr.To(int32(-1))
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.replicaCount")
+		})
+
+		It("Should deny a name too long for the redis service", func() {
+			myappresource.Name = strings.Repeat("a", 60)
+			err := k8sClient.Create(ctx, myappresource)
+			expectInvalid(err, "metadata.name")
+			Expect(err.Error()).To(ContainSubstring(`"-redis" suffix`))
+		})
+
+		It("Should deny a name too long for the redis headless service with persistence", func() {
+			myappresource.Name = strings.Repeat("a", 50)
+			myappresource.Spec.Redis.Persistence.Enabled = true
+			err := k8sClient.Create(ctx, myappresource)
+			expectInvalid(err, "metadata.name")
+			Expect(err.Error()).To(ContainSubstring(`"-redis-headless" suffix`))
+		})
+
+		It("Should deny a name that is not a DNS-1035 label", func() {
+			myappresource.Name = "1-podinfo"
+			expectInvalid(k8sClient.Create(ctx, myappresource), "metadata.name")
+		})
+
+		It("Should deny memory limits below requests", func() {
+			myappresource.Spec.Resources.MemoryLimit = resource.MustParse("16Mi")
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.resources.memoryLimit")
+
+			myappresource.Spec.Resources.MemoryLimit = resource.MustParse("64Mi")
+			myappresource.Spec.Redis.Resources.MemoryRequest = resource.MustParse("1Gi")
+			myappresource.Spec.Redis.Resources.MemoryLimit = resource.MustParse("512Mi")
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.redis.resources.memoryLimit")
+		})
+	})
+
+	Context("When enabling autoscaling under Validating Webhook", func() {
+		It("Should require a replica range", func() {
+			myappresource.Spec.Autoscaling = Autoscaling{Enabled: true}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.autoscaling.maxReplicas")
+
+			myappresource.Spec.Autoscaling = Autoscaling{Enabled: true, MinReplicas: ptr.To(int32(4)), MaxReplicas: 3}
+			expectInvalid(k8sClient.Create(ctx, myappresource), "spec.autoscaling.maxReplicas")
+		})
+	})
+
+	Context("When updating MyAppResource under Validating Webhook", func() {
+		It("Should deny an invalid update", func() {
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+			myappresource.Spec.ReplicaCount = ptr.To(int32(-3))
+			expectInvalid(k8sClient.Update(ctx, myappresource), "spec.replicaCount")
+		})
+
+		It("Should deny resizing persistent redis storage", func() {
+			myappresource.Spec.Redis.Persistence = RedisPersistence{Enabled: true, Size: resource.MustParse("1Gi")}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+
+			myappresource.Spec.Redis.Persistence.Size = resource.MustParse("2Gi")
+			expectInvalid(k8sClient.Update(ctx, myappresource), "spec.redis.persistence.size")
+
+			By("allowing the size to change along with disabling persistence")
+			myappresource.Spec.Redis.Persistence.Enabled = false
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+		})
+
+		It("Should deny switching the operator's redis to an external one", func() {
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.External = &RedisExternal{Address: "cache.example.com", Port: 6379}
+			expectInvalid(k8sClient.Update(ctx, myappresource), "spec.redis.external")
+		})
+
+		It("Should allow an external redis once the operator's redis is disabled", func() {
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.Enabled = false
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+
+			myappresource.Spec.Redis.Enabled = true
+			myappresource.Spec.Redis.External = &RedisExternal{Address: "cache.example.com", Port: 6379}
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+
+			By("allowing the external redis to be changed and switched back to the operator's")
+			myappresource.Spec.Redis.External.Address = "other-cache.example.com"
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.External = nil
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+		})
+
+		It("Should deny spec changes while the myappresource is being deleted", func() {
+			myappresource.Finalizers = []string{MyAppResourceFinalizer}
+			Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, myappresource)).To(Succeed())
+
+			key := types.NamespacedName{Name: myappresource.Name, Namespace: myappresource.Namespace}
+			Expect(k8sClient.Get(ctx, key, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.Enabled = false
+			expectInvalid(k8sClient.Update(ctx, myappresource), "spec")
+
+			By("still allowing the finalizer to be removed")
+			Expect(k8sClient.Get(ctx, key, myappresource)).To(Succeed())
+			myappresource.Finalizers = nil
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+		})
+	})
+})
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
@@ -25,14 +26,24 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
 	"podinfo-operator.com/m/v2/internal/controller"
@@ -46,6 +57,9 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1alpha2.AddToScheme(scheme))
+	utilruntime.Must(monitoringv1.AddToScheme(scheme))
 
 	utilruntime.Must(podinfov1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
@@ -57,6 +71,10 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var otlpEndpoint string
+	var otlpInsecure bool
+	var traceStdout bool
+	var traceSamplingRatio float64
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -66,6 +84,14 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"The host:port of the OTLP gRPC collector reconcile traces are exported to. Tracing is off if unset.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false,
+		"If set, traces are exported to the OTLP collector without TLS")
+	flag.BoolVar(&traceStdout, "trace-stdout", false,
+		"If set, traces are printed to stdout instead of exported, to debug tracing locally")
+	flag.Float64Var(&traceSamplingRatio, "trace-sampling-ratio", 1,
+		"The ratio of reconciles traced, between 0 and 1. Reconciles with a sampled parent are always traced.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -74,6 +100,13 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	shutdownTracing, err := setupTracing(context.Background(), otlpEndpoint, otlpInsecure, traceStdout,
+		traceSamplingRatio)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancelation and
@@ -94,8 +127,16 @@ func main() {
 		TLSOpts: tlsOpts,
 	})
 
+	cacheByObject, err := controller.CacheByObject()
+	if err != nil {
+		setupLog.Error(err, "unable to set up the cache")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		// Only the Redis password Secrets are cached, rather than every Secret of the cluster.
+		Cache: cache.Options{ByObject: cacheByObject},
 		Metrics: metricsserver.Options{
 			BindAddress:   metricsAddr,
 			SecureServing: secureMetrics,
@@ -123,12 +164,20 @@ func main() {
 	}
 
 	if err = (&controller.MyAppResourceReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("podinfo-operator"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MyAppResource")
 		os.Exit(1)
 	}
+	// Webhooks need serving certificates, so they can be turned off to run the manager locally.
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&podinfov1alpha1.MyAppResource{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MyAppResource")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -145,4 +194,42 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	// Flush the spans still batched for export.
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "problem shutting down tracing")
+	}
+}
+
+// setupTracing installs the global tracer provider the reconciler's spans are exported through, sampling the given
+// ratio of reconciles. Spans are exported to the OTLP collector at endpoint, or printed if stdout is set; with neither,
+// tracing is left off. The returned function flushes and shuts the provider down.
+func setupTracing(
+	ctx context.Context, endpoint string, insecure, stdout bool, ratio float64,
+) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch {
+	case stdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case endpoint != "":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("podinfo-operator"))),
+	)
+	otel.SetTracerProvider(provider)
+	setupLog.Info("tracing reconciles", "endpoint", endpoint, "stdout", stdout, "samplingRatio", ratio)
+	return provider.Shutdown, nil
 }
@@ -0,0 +1,151 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	k8serrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// fieldOwner is the field manager every child resource is server-side applied under.
+const fieldOwner = "podinfo-operator"
+
+// legacyFieldManagers are the field managers earlier releases of the operator wrote children with, via plain
+// Create/Update calls. Their managed fields are handed over to fieldOwner so fields the operator stops setting are
+// actually removed rather than kept alive by the stale Update entry.
+var legacyFieldManagers = sets.New("manager")
+
+// apply server-side applies the desired child of myApp under the operator's field manager, unless the observed object
+// already matches it, and records the creation or update as a child write of myApp. An observed object that is not the
+// operator's to overwrite is left alone, and a conflictError returned.
+//
+// desired must only carry the fields the operator owns; ownership of those fields is forced, while any field set by
+// another manager (HPA replicas, injected sidecars, extra labels and annotations...) is left alone.
+func (r *MyAppResourceReconciler) apply(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource, desired client.Object,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "apply", myApp, attrResourceName.String(desired.GetName()))
+	defer func() { endSpan(span, err) }()
+
+	gvk, err := apiutil.GVKForObject(desired, r.Scheme)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attrResourceKind.String(gvk.Kind))
+	desired.GetObjectKind().SetGroupVersionKind(gvk)
+
+	hash, err := desiredHash(desired)
+	if err != nil {
+		return err
+	}
+	// The annotations of desired may be shared with the myApp spec it was built from, so they are not written to.
+	annotations := maps.Clone(desired.GetAnnotations())
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[appliedHashAnnotation] = hash
+	desired.SetAnnotations(annotations)
+
+	// Compare against the observed object, if any, and skip the write when nothing meaningful differs.
+	obj, err := r.Scheme.New(gvk)
+	if err != nil {
+		return err
+	}
+	observed := obj.(client.Object)
+	err = r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, observed)
+	if err != nil && !k8serrs.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		if err := checkApplyOwnership(gvk.Kind, desired, observed); err != nil {
+			return err
+		}
+		if changed, err := needsApply(desired, observed); err != nil {
+			return err
+		} else if !changed {
+			log.FromContext(ctx).V(1).Info("Skipping apply of unchanged "+gvk.Kind, "name", desired.GetName())
+			childApplyTotal.WithLabelValues(gvk.Kind, applyResultSkipped).Inc()
+			span.SetAttributes(attrApplyResult.String(applyResultSkipped))
+			return nil
+		}
+		if err := r.upgradeManagedFields(ctx, observed); err != nil {
+			return fmt.Errorf("error upgrading managed fields of %s %s: %w", gvk.Kind, desired.GetName(), err)
+		}
+	}
+
+	created := err != nil
+	childApplyTotal.WithLabelValues(gvk.Kind, applyResultApplied).Inc()
+	span.SetAttributes(attrApplyResult.String(applyResultApplied))
+	if err := r.Patch(ctx, desired, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+		return err
+	}
+	if created {
+		r.recordChildWrite(myApp, writeVerbCreate, gvk.Kind, desired.GetName())
+	} else {
+		r.recordChildWrite(myApp, writeVerbUpdate, gvk.Kind, desired.GetName())
+	}
+	return nil
+}
+
+// upgradeManagedFields migrates the managed fields of an existing object from the legacy client-side field managers
+// to fieldOwner. It is a no-op for objects that were already migrated.
+func (r *MyAppResourceReconciler) upgradeManagedFields(ctx context.Context, existing client.Object) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(existing, legacyFieldManagers, fieldOwner)
+	if err != nil || patch == nil {
+		return err
+	}
+	return r.Patch(ctx, existing, client.RawPatch(types.JSONPatchType, patch))
+}
+
+// managedByOthers reports whether a field manager other than fieldOwner manages the field of obj at path, given as
+// managed fields keys such as "f:spec", "f:replicas".
+func managedByOthers(obj client.Object, path ...string) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == fieldOwner || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		for i, key := range path {
+			value, ok := fields[key]
+			if !ok {
+				break
+			}
+			if i == len(path)-1 {
+				return true
+			}
+			if fields, ok = value.(map[string]interface{}); !ok {
+				break
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+var _ = Describe("MyAppResource Server-Side Apply", func() {
+	const namespace = "server-side-apply"
+
+	ctx := context.Background()
+
+	// newMyApp creates a MyAppResource in the test namespace.
+	newMyApp := func(name string, redis bool) *podinfov1alpha1.MyAppResource {
+		myappresource := &podinfov1alpha1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: podinfov1alpha1.MyAppResourceSpec{
+				ReplicaCount: ptr(int32(2)),
+				Image: podinfov1alpha1.Image{
+					Repository: "ghcr.io/stefanprodan/podinfo",
+					Tag:        "latest",
+				},
+				Resources: podinfov1alpha1.Resources{CPURequest: *resource.NewQuantity(100, "m")},
+				Redis:     podinfov1alpha1.Redis{Enabled: redis},
+			},
+		}
+		Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+		return myappresource
+	}
+
+	BeforeEach(func() {
+		namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+		Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+	})
+
+	It("should keep fields set by other field managers across reconciles", func() {
+		myappresource := newMyApp("foreign-fields", false)
+		namespacedName := types.NamespacedName{Name: myappresource.Name, Namespace: namespace}
+		performReconcilation(ctx, namespacedName)
+
+		By("letting another manager inject a sidecar, a label and an annotation")
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+		deployment.Labels["team"] = "platform"
+		deployment.Annotations = map[string]string{"example.com/injected": "true"}
+		deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers,
+			corev1.Container{Name: "sidecar", Image: "busybox"})
+		Expect(k8sClient.Update(ctx, deployment, client.FieldOwner("sidecar-injector"))).To(Succeed())
+
+		svc := &corev1.Service{}
+		Expect(k8sClient.Get(ctx, namespacedName, svc)).To(Succeed())
+		svc.Annotations = map[string]string{"example.com/load-balancer": "internal"}
+		Expect(k8sClient.Update(ctx, svc, client.FieldOwner("cloud-controller"))).To(Succeed())
+
+		By("changing the myappresource spec and reconciling again")
+		Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+		myappresource.Spec.UI.Message = "updated"
+		Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+		performReconcilation(ctx, namespacedName)
+
+		By("finding the operator's change alongside the other manager's fields")
+		Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+		Expect(deployment.Labels).To(HaveKeyWithValue("team", "platform"))
+		Expect(deployment.Annotations).To(HaveKeyWithValue("example.com/injected", "true"))
+		Expect(deployment.Spec.Template.Spec.Containers).To(HaveLen(2))
+		Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(
+			ContainElement(corev1.EnvVar{Name: "PODINFO_UI_MESSAGE", Value: "updated"}))
+		Expect(deployment.Spec.Template.Spec.Containers[1].Name).To(Equal("sidecar"))
+
+		Expect(k8sClient.Get(ctx, namespacedName, svc)).To(Succeed())
+		Expect(svc.Annotations).To(HaveKeyWithValue("example.com/load-balancer", "internal"))
+	})
+
+	It("should take over fields written by earlier client-side updates", func() {
+		myappresource := newMyApp("legacy-fields", true)
+		namespacedName := types.NamespacedName{Name: myappresource.Name, Namespace: namespace}
+
+		By("creating the deployment the way earlier releases did")
+		Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+		Expect(k8sClient.Create(ctx, buildDeployment(myappresource), client.FieldOwner("manager"))).To(Succeed())
+
+		By("disabling redis and reconciling")
+		myappresource.Spec.Redis.Enabled = false
+		Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+		performReconcilation(ctx, namespacedName)
+
+		By("finding the redis cache server removed from the podinfo container")
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Env).NotTo(
+			ContainElement(HaveField("Name", "PODINFO_CACHE_SERVER")))
+		for _, managedFields := range deployment.ManagedFields {
+			Expect(managedFields.Manager).NotTo(Equal("manager"))
+		}
+	})
+	It("should leave the annotations of the desired object alone", func() {
+		myappresource := newMyApp("desired-annotations", false)
+		annotations := map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "false"}
+		myappresource.Spec.Ingress = &podinfov1alpha1.Ingress{Annotations: annotations}
+		desired := buildIngress(myappresource)
+		desired.Annotations = annotations
+
+		controllerReconciler := &MyAppResourceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		Expect(controllerReconciler.apply(ctx, myappresource, desired)).To(Succeed())
+		Expect(annotations).To(HaveLen(1))
+		Expect(desired.Annotations).To(HaveKey(appliedHashAnnotation))
+
+		ingress := &networkingv1.Ingress{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(desired), ingress)).To(Succeed())
+		Expect(ingress.Annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/ssl-redirect", "false"))
+		Expect(ingress.Annotations).To(HaveKey(appliedHashAnnotation))
+	})
+	It("should move a redis deployment of earlier releases to a single instance", func() {
+		myappresource := newMyApp("rolling-redis", true)
+		namespacedName := types.NamespacedName{Name: myappresource.Name, Namespace: namespace}
+		redisNamespacedName := types.NamespacedName{Name: myappresource.Name + redisNamePostfix, Namespace: namespace}
+
+		By("applying the redis deployment the way earlier releases did")
+		Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+		legacy := buildRedisDeployment(myappresource)
+		legacy.Spec.Replicas = myappresource.Spec.ReplicaCount
+		legacy.Spec.Strategy = appsv1.DeploymentStrategy{}
+		legacy.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+		Expect(k8sClient.Patch(ctx, legacy, client.Apply, client.FieldOwner(fieldOwner))).To(Succeed())
+
+		performReconcilation(ctx, namespacedName)
+
+		redisDep := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, redisNamespacedName, redisDep)).To(Succeed())
+		Expect(*redisDep.Spec.Replicas).To(Equal(int32(1)))
+		Expect(redisDep.Spec.Strategy.RollingUpdate.MaxSurge.IntValue()).To(BeZero())
+		Expect(redisDep.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue()).To(Equal(1))
+	})
+})
@@ -0,0 +1,232 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+const (
+	redisAuthNamePostfix = podinfov1alpha1.RedisAuthNameSuffix
+
+	// redisAuthHashAnnotation carries a hash of the Redis password on the podinfo and Redis pod templates, so
+	// rotating the password rolls both out together.
+	redisAuthHashAnnotation = "myappresource.podinfo.podinfo.com/redis-auth-hash"
+
+	// redisAuthSecretIndex indexes MyAppResources by the Secret their Redis password is read from.
+	redisAuthSecretIndex = ".spec.redis.auth.secretRef.name"
+
+	// redisPasswordEnv is the container environment variable the Redis password is exposed as.
+	redisPasswordEnv = "REDIS_PASSWORD"
+)
+
+// CacheByObject restricts the manager's cache of Secrets to those labelled with MyAppResourceLabelName, the Redis
+// password Secrets, so the operator does not keep every Secret of the cluster in memory. The generated Secret carries
+// the label; a Secret named by secretRef is only read once it does too.
+func CacheByObject() (map[client.Object]cache.ByObject, error) {
+	labelled, err := labels.NewRequirement(podinfov1alpha1.MyAppResourceLabelName, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	return map[client.Object]cache.ByObject{&corev1.Secret{}: {Label: labels.NewSelector().Add(*labelled)}}, nil
+}
+
+// redisAuthEnabled reports whether Redis is used, and used with a password.
+func redisAuthEnabled(myApp *podinfov1alpha1.MyAppResource) bool {
+	if external := redisExternal(myApp); external != nil {
+		return external.SecretRef != nil
+	}
+	return myApp.Spec.Redis.Enabled && myApp.Spec.Redis.Auth.Enabled
+}
+
+// redisAuthSecretRef returns the Secret reference the Redis password of myApp is read from, or nil when the operator
+// generates the password.
+func redisAuthSecretRef(myApp *podinfov1alpha1.MyAppResource) *podinfov1alpha1.SecretKeyReference {
+	if external := redisExternal(myApp); external != nil {
+		return external.SecretRef
+	}
+	return myApp.Spec.Redis.Auth.SecretRef
+}
+
+// redisAuthSecretKeySelector returns the Secret key the Redis password of myApp is read from.
+func redisAuthSecretKeySelector(myApp *podinfov1alpha1.MyAppResource) *corev1.SecretKeySelector {
+	ref := redisAuthSecretRef(myApp)
+	if ref == nil {
+		return &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: myApp.Name + redisAuthNamePostfix},
+			Key:                  podinfov1alpha1.DefaultSecretKey,
+		}
+	}
+	key := ref.Key
+	if key == "" {
+		key = podinfov1alpha1.DefaultSecretKey
+	}
+	return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name}, Key: key}
+}
+
+// reconcileRedisAuth makes sure the Redis password exists and returns a hash of it, or "" while auth is disabled.
+// A generated password Secret that is no longer used is deleted.
+func (r *MyAppResourceReconciler) reconcileRedisAuth(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (authHash string, err error) {
+	ctx, span := r.startSpan(ctx, "reconcileRedisAuth", myApp)
+	defer func() { endSpan(span, err) }()
+	if !redisAuthEnabled(myApp) || redisAuthSecretRef(myApp) != nil {
+		if err := r.deleteGeneratedRedisAuthSecret(ctx, myApp); err != nil {
+			return "", err
+		}
+	}
+	if !redisAuthEnabled(myApp) {
+		return "", nil
+	}
+
+	selector := redisAuthSecretKeySelector(myApp)
+	secret := &corev1.Secret{}
+	err = r.Get(ctx, types.NamespacedName{Name: selector.Name, Namespace: myApp.Namespace}, secret)
+	if k8serrs.IsNotFound(err) && redisAuthSecretRef(myApp) == nil {
+		secret, err = r.createRedisAuthSecret(ctx, myApp)
+	} else if k8serrs.IsNotFound(err) {
+		return "", fmt.Errorf("error getting redis auth secret %s, which must be labelled %s: %w",
+			selector.Name, podinfov1alpha1.MyAppResourceLabelName, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting redis auth secret %s: %w", selector.Name, err)
+	}
+	// A Secret of the generated name that the operator did not create is someone else's password, not ours to use.
+	if redisAuthSecretRef(myApp) == nil && !ownedBy(secret, myApp) {
+		return "", &conflictError{"Secret", secret.Name, "it is not controlled by and labelled for the myappresource"}
+	}
+
+	password, ok := secret.Data[selector.Key]
+	if !ok || len(password) == 0 {
+		return "", fmt.Errorf("redis auth secret %s has no %q key", selector.Name, selector.Key)
+	}
+	sum := sha256.Sum256(password)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// createRedisAuthSecret generates a random Redis password into a Secret owned by myApp. The Secret is created
+// rather than applied, so the password is only ever generated once.
+func (r *MyAppResourceReconciler) createRedisAuthSecret(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (*corev1.Secret, error) {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name + redisAuthNamePostfix,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Type: corev1.SecretTypeOpaque,
+		// Hex keeps the password URL-safe for podinfo's cache server URL.
+		Data: map[string][]byte{podinfov1alpha1.DefaultSecretKey: []byte(hex.EncodeToString(password))},
+	}
+	log.FromContext(ctx).V(1).Info("Creating Redis auth Secret", "secret", secret.Name)
+	if err := r.Create(ctx, secret, client.FieldOwner(fieldOwner)); err != nil {
+		return nil, err
+	}
+	r.recordChildWrite(myApp, writeVerbCreate, "Secret", secret.Name)
+	return secret, nil
+}
+
+// deleteGeneratedRedisAuthSecret deletes the generated Redis password Secret, if myApp still owns one.
+func (r *MyAppResourceReconciler) deleteGeneratedRedisAuthSecret(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) error {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: myApp.Name + redisAuthNamePostfix, Namespace: myApp.Namespace}, secret)
+	// A secretRef may name a Secret of the generated name; only a Secret the operator created is deleted.
+	if err != nil || !ownedBy(secret, myApp) {
+		return client.IgnoreNotFound(err)
+	}
+	log.FromContext(ctx).V(1).Info("Deleting Redis auth Secret", "secret", secret.Name)
+	uid := secret.GetUID()
+	if err := r.Delete(ctx, secret, client.Preconditions{UID: &uid}); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.recordChildWrite(myApp, writeVerbDelete, "Secret", secret.Name)
+	return nil
+}
+
+// setRedisAuthHash annotates a pod template with the Redis password hash, so a new password rolls its pods out.
+func setRedisAuthHash(template *corev1.PodTemplateSpec, authHash string) {
+	if authHash == "" {
+		return
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[redisAuthHashAnnotation] = authHash
+}
+
+// indexRedisAuthSecret is the redisAuthSecretIndex indexer.
+func indexRedisAuthSecret(obj client.Object) []string {
+	myApp := obj.(*podinfov1alpha1.MyAppResource)
+	if ref := redisAuthSecretRef(myApp); redisAuthEnabled(myApp) && ref != nil {
+		return []string{ref.Name}
+	}
+	return nil
+}
+
+// findMyAppResourcesForSecret maps a Secret to the MyAppResource controlling it, if any, and to the MyAppResources
+// reading their Redis password from it.
+func (r *MyAppResourceReconciler) findMyAppResourcesForSecret(
+	ctx context.Context, secret client.Object,
+) []reconcile.Request {
+	requests := []reconcile.Request{}
+	if owner := metav1.GetControllerOf(secret); owner != nil && owner.Kind == "MyAppResource" &&
+		owner.APIVersion == podinfov1alpha1.GroupVersion.String() {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: owner.Name, Namespace: secret.GetNamespace()},
+		})
+	}
+	myApps := &podinfov1alpha1.MyAppResourceList{}
+	if err := r.List(ctx, myApps, client.InNamespace(secret.GetNamespace()),
+		client.MatchingFields{redisAuthSecretIndex: secret.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "error listing myappresources for secret", "secret", secret.GetName())
+		return requests
+	}
+	for _, myApp := range myApps.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: myApp.Name, Namespace: myApp.Namespace},
+		})
+	}
+	return requests
+}
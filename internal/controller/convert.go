@@ -18,19 +18,37 @@ package controller
 
 import (
 	"fmt"
+	"maps"
+	"net"
+	"strconv"
 
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 
 	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
 )
 
 const (
-	redisNamePostfix = "-redis"
+	redisNamePostfix         = podinfov1alpha1.RedisNameSuffix
+	redisHeadlessNamePostfix = podinfov1alpha1.RedisHeadlessNameSuffix
+
+	// alertNameLabel and alertNamespaceLabel label every podinfo alert with its MyAppResource. Prometheus label names
+	// cannot carry the MyAppResource label's domain prefix.
+	alertNameLabel      = "myappresource"
+	alertNamespaceLabel = "namespace"
+
+	// redisDataVolume names the volume claim template, and so the volume, holding the persistent redis data.
+	redisDataVolume = "data"
 )
 
 // buildService builds a service for a podinfo deployment.
@@ -43,21 +61,31 @@ func buildService(myApp *podinfov1alpha1.MyAppResource) *corev1.Service {
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            myApp.Name,
-			Namespace:       "default",
+			Namespace:       myApp.Namespace,
 			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
 			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
 		},
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{
-				{Name: "http", Port: 9898, TargetPort: intstr.FromString("http")},
-				{Name: "grpc", Port: 9999, TargetPort: intstr.FromString("grpc")},
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 9898, TargetPort: intstr.FromString("http")},
+				{Name: "grpc", Protocol: corev1.ProtocolTCP, Port: 9999, TargetPort: intstr.FromString("grpc")},
 			},
 			Selector: map[string]string{"app.kubernetes.io/name": myApp.Name},
 		},
 	}
+	if myApp.Spec.Monitoring.Enabled {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+			Name: "http-metrics", Protocol: corev1.ProtocolTCP, Port: 9797, TargetPort: intstr.FromString("http-metrics"),
+		})
+	}
 	return svc
 }
 
+// selectorLabels returns the labels selecting the podinfo pods of a myApp.
+func selectorLabels(myApp *podinfov1alpha1.MyAppResource) map[string]string {
+	return map[string]string{"app.kubernetes.io/name": myApp.Name}
+}
+
 // buildDeployment converts a MyAppResourceSpec to a k8s Deployment Spec.
 func buildDeployment(myApp *podinfov1alpha1.MyAppResource) *appsv1.Deployment {
 	ownerGVK := schema.GroupVersionKind{
@@ -69,49 +97,83 @@ func buildDeployment(myApp *podinfov1alpha1.MyAppResource) *appsv1.Deployment {
 
 	// TODO: (reedjosh) use a better labeling scheme.
 	dep.Name = myApp.Name
-	dep.Namespace = "default"
-	dep.Labels = map[string]string{"app.kubernetes.io/name": myApp.Name}
+	dep.Namespace = myApp.Namespace
+	dep.Labels = map[string]string{
+		"app.kubernetes.io/name":               myApp.Name,
+		podinfov1alpha1.MyAppResourceLabelName: myApp.Name,
+	}
 	dep.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)}
 	dep.Spec.Template.Labels = map[string]string{"app.kubernetes.io/name": myApp.Name}
-	dep.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/name": myApp.Name}}
-	dep.Spec.Replicas = myApp.Spec.ReplicaCount
+	dep.Spec.Selector = &metav1.LabelSelector{MatchLabels: selectorLabels(myApp)}
+	// While autoscaling, the replica count is left to the HorizontalPodAutoscaler. Not applying it also drops this
+	// field manager's ownership of it, so the two never fight over it; see createOrUpdateDeployment for the handover.
+	if !myApp.Spec.Autoscaling.Enabled {
+		dep.Spec.Replicas = myApp.Spec.ReplicaCount
+	}
+	// The webhook defaults the repository, but it may not be installed.
+	repository := myApp.Spec.Image.Repository
+	if repository == "" {
+		repository = podinfov1alpha1.DefaultImageRepository
+	}
 	dep.Spec.Template.Spec.Containers = []corev1.Container{
 		{
-			Name:  "podinfo",
-			Image: fmt.Sprintf("%s:%s", myApp.Spec.Image.Repository, myApp.Spec.Image.Tag),
-			Resources: corev1.ResourceRequirements{
-				Limits:   corev1.ResourceList{corev1.ResourceMemory: myApp.Spec.Resources.MemoryLimit},
-				Requests: corev1.ResourceList{corev1.ResourceCPU: myApp.Spec.Resources.CPURequest},
-			},
+			Name:            "podinfo",
+			Image:           fmt.Sprintf("%s:%s", repository, myApp.Spec.Image.Tag),
+			ImagePullPolicy: myApp.Spec.Image.PullPolicy,
+			Resources:       buildResourceRequirements(myApp.Spec.Resources),
 			Env: []corev1.EnvVar{
 				{Name: "PODINFO_UI_COLOR", Value: myApp.Spec.UI.Color},
 				{Name: "PODINFO_UI_MESSAGE", Value: myApp.Spec.UI.Message},
 			},
 			Ports: []corev1.ContainerPort{
-				{ContainerPort: 9898, Name: "http"},
-				{ContainerPort: 9797, Name: "http-metrics"},
-				{ContainerPort: 9999, Name: "grpc"},
+				{ContainerPort: 9898, Name: "http", Protocol: corev1.ProtocolTCP},
+				{ContainerPort: 9797, Name: "http-metrics", Protocol: corev1.ProtocolTCP},
+				{ContainerPort: 9999, Name: "grpc", Protocol: corev1.ProtocolTCP},
 			},
+			LivenessProbe:  buildProbe(podinfoLivenessProbe, myApp.Spec.Probes.Liveness),
+			ReadinessProbe: buildProbe(podinfoReadinessProbe, myApp.Spec.Probes.Readiness),
+			StartupProbe:   buildProbe(podinfoStartupProbe, myApp.Spec.Probes.Startup),
 		},
 	}
 
 	// If Redis is enabled, set env var as such.
 	if myApp.Spec.Redis.Enabled {
+		// With auth, the password is sourced from its Secret and expanded into the cache server URL by the kubelet.
+		if redisAuthEnabled(myApp) {
+			dep.Spec.Template.Spec.Containers[0].Env = append(
+				dep.Spec.Template.Spec.Containers[0].Env, buildRedisPasswordEnv(myApp))
+		}
 		dep.Spec.Template.Spec.Containers[0].Env = append(
 			dep.Spec.Template.Spec.Containers[0].Env,
-			corev1.EnvVar{
-				Name: "PODINFO_CACHE_SERVER",
-				Value: fmt.Sprintf(
-					"tcp://%s.%s.svc.cluster.local:6379",
-					myApp.Name+redisNamePostfix,
-					myApp.Namespace),
-			},
+			corev1.EnvVar{Name: "PODINFO_CACHE_SERVER", Value: buildRedisCacheServer(myApp)},
 		)
 	}
 
 	return dep
 }
 
+// buildRedisCacheServer returns podinfo's cache server URL: the external Redis when one is set, the operator's Redis
+// Service otherwise.
+func buildRedisCacheServer(myApp *podinfov1alpha1.MyAppResource) string {
+	scheme := "tcp"
+	host := fmt.Sprintf("%s.%s.svc.cluster.local", myApp.Name+redisNamePostfix, myApp.Namespace)
+	port := int32(6379)
+	if external := redisExternal(myApp); external != nil {
+		host, port = external.Address, external.Port
+		if port == 0 {
+			port = podinfov1alpha1.DefaultRedisPort
+		}
+		if external.TLS {
+			scheme = "rediss"
+		}
+	}
+	credentials := ""
+	if redisAuthEnabled(myApp) {
+		credentials = fmt.Sprintf(":$(%s)@", redisPasswordEnv)
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, credentials, net.JoinHostPort(host, strconv.Itoa(int(port))))
+}
+
 // buildService builds a service for a podinfo deployment.
 func buildRedisService(myApp *podinfov1alpha1.MyAppResource) *corev1.Service {
 	ownerGVK := schema.GroupVersionKind{
@@ -122,13 +184,13 @@ func buildRedisService(myApp *podinfov1alpha1.MyAppResource) *corev1.Service {
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            myApp.Name + redisNamePostfix,
-			Namespace:       "default",
+			Namespace:       myApp.Namespace,
 			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
 			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
 		},
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{
-				{Name: "redis", Port: 6379, TargetPort: intstr.FromString("redis")},
+				{Name: "redis", Protocol: corev1.ProtocolTCP, Port: 6379, TargetPort: intstr.FromString("redis")},
 			},
 			Selector: map[string]string{"app.kubernetes.io/name": myApp.Name + redisNamePostfix},
 		},
@@ -143,22 +205,607 @@ func buildRedisDeployment(myApp *podinfov1alpha1.MyAppResource) *appsv1.Deployme
 	// TODO: (reedjosh) use a better labeling scheme.
 	dep := &appsv1.Deployment{}
 	dep.Name = myApp.Name + redisNamePostfix
-	dep.Namespace = "default"
-	dep.Labels = map[string]string{"app.kubernetes.io/name": myApp.Name}
+	dep.Namespace = myApp.Namespace
+	dep.Labels = map[string]string{
+		"app.kubernetes.io/name":               myApp.Name,
+		podinfov1alpha1.MyAppResourceLabelName: myApp.Name,
+	}
 	dep.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)}
-	dep.Spec.Replicas = myApp.Spec.ReplicaCount
+	// A single Redis instance is the one cache every podinfo replica shares, independent of the podinfo replica count.
+	// Rolling without surge stops the old instance before the new one starts, so a rollout never splits the cache.
+	// (A Recreate strategy would do the same, but cannot be applied over the defaulted rollingUpdate of existing
+	// deployments.)
+	redisReplicas := int32(1)
+	maxSurge, maxUnavailable := intstr.FromInt32(0), intstr.FromInt32(1)
+	dep.Spec.Replicas = &redisReplicas
+	dep.Spec.Strategy = appsv1.DeploymentStrategy{
+		Type:          appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &maxSurge, MaxUnavailable: &maxUnavailable},
+	}
 	dep.Spec.Template.Labels = map[string]string{"app.kubernetes.io/name": myApp.Name + redisNamePostfix}
 	dep.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/name": myApp.Name + redisNamePostfix}}
-	dep.Spec.Template.Spec.Containers = append(dep.Spec.Template.Spec.Containers,
-		corev1.Container{
-			Name:  "redis",
-			Image: "redis:alpine3.19",
-			Resources: corev1.ResourceRequirements{
-				Limits:   corev1.ResourceList{corev1.ResourceMemory: myApp.Spec.Redis.Resources.MemoryLimit},
-				Requests: corev1.ResourceList{corev1.ResourceCPU: myApp.Spec.Redis.Resources.CPURequest},
+	dep.Spec.Template.Spec.Containers = []corev1.Container{buildRedisContainer(myApp)}
+	return dep
+}
+
+// buildRedisHeadlessService builds the headless service governing a persistent redis statefulset.
+func buildRedisHeadlessService(myApp *podinfov1alpha1.MyAppResource) *corev1.Service {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name + redisHeadlessNamePostfix,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Ports: []corev1.ServicePort{
+				{Name: "redis", Protocol: corev1.ProtocolTCP, Port: 6379, TargetPort: intstr.FromString("redis")},
 			},
-			Ports: []corev1.ContainerPort{{Name: "redis", ContainerPort: 6379}},
+			Selector: map[string]string{"app.kubernetes.io/name": myApp.Name + redisNamePostfix},
 		},
-	)
-	return dep
+	}
+	return svc
+}
+
+// buildRedisStatefulSet converts a MyAppResourceSpec to a k8s StatefulSet Spec running a persistent redis. Its pods
+// carry the same labels as those of buildRedisDeployment, so the redis service selects either.
+func buildRedisStatefulSet(myApp *podinfov1alpha1.MyAppResource) *appsv1.StatefulSet {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	persistence := myApp.Spec.Redis.Persistence
+
+	sts := &appsv1.StatefulSet{}
+	sts.Name = myApp.Name + redisNamePostfix
+	sts.Namespace = myApp.Namespace
+	sts.Labels = map[string]string{
+		"app.kubernetes.io/name":               myApp.Name,
+		podinfov1alpha1.MyAppResourceLabelName: myApp.Name,
+	}
+	sts.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)}
+	// A single instance, as for buildRedisDeployment. A StatefulSet replaces its pod before starting the next anyway.
+	redisReplicas := int32(1)
+	sts.Spec.Replicas = &redisReplicas
+	sts.Spec.ServiceName = myApp.Name + redisHeadlessNamePostfix
+	sts.Spec.Template.Labels = map[string]string{"app.kubernetes.io/name": myApp.Name + redisNamePostfix}
+	sts.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/name": myApp.Name + redisNamePostfix}}
+
+	container := buildRedisContainer(myApp)
+	container.VolumeMounts = []corev1.VolumeMount{{Name: redisDataVolume, MountPath: "/data"}}
+	switch persistence.Mode {
+	case podinfov1alpha1.RedisPersistenceRDB:
+		container.Args = append([]string{"--appendonly", "no", "--save", "3600 1 300 100 60 10000"}, container.Args...)
+	default:
+		container.Args = append([]string{"--appendonly", "yes"}, container.Args...)
+	}
+	sts.Spec.Template.Spec.Containers = []corev1.Container{container}
+
+	sts.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   redisDataVolume,
+				Labels: map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: persistence.StorageClassName,
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: persistence.Size},
+				},
+			},
+		},
+	}
+	return sts
+}
+
+// buildRedisContainer builds the redis container shared by the redis deployment and statefulset.
+func buildRedisContainer(myApp *podinfov1alpha1.MyAppResource) corev1.Container {
+	redisImage := podinfov1alpha1.DefaultRedisImage
+	if myApp.Spec.Redis.Image != nil {
+		redisImage = *myApp.Spec.Redis.Image
+	}
+	container := corev1.Container{
+		Name:            "redis",
+		Image:           fmt.Sprintf("%s:%s", redisImage.Repository, redisImage.Tag),
+		ImagePullPolicy: redisImage.PullPolicy,
+		Resources:       buildResourceRequirements(myApp.Spec.Redis.Resources),
+		Ports:           []corev1.ContainerPort{{Name: "redis", ContainerPort: 6379, Protocol: corev1.ProtocolTCP}},
+		LivenessProbe:   buildProbe(redisLivenessProbe, myApp.Spec.Redis.Probes.Liveness),
+		ReadinessProbe:  buildProbe(redisReadinessProbe, myApp.Spec.Redis.Probes.Readiness),
+		StartupProbe:    buildProbe(redisStartupProbe, myApp.Spec.Redis.Probes.Startup),
+	}
+	if redisAuthEnabled(myApp) {
+		// redis-cli, as run by the readiness probe, authenticates with REDISCLI_AUTH.
+		container.Env = []corev1.EnvVar{
+			buildRedisPasswordEnv(myApp),
+			{Name: "REDISCLI_AUTH", Value: fmt.Sprintf("$(%s)", redisPasswordEnv)},
+		}
+		container.Args = []string{"--requirepass", fmt.Sprintf("$(%s)", redisPasswordEnv)}
+	}
+	return container
+}
+
+// Default health probes. podinfo serves /healthz and /readyz on its http port. Redis is live once it accepts
+// connections, and ready once it answers a PING, which it does not while still loading its data from disk.
+var (
+	podinfoLivenessProbe = corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("http")},
+		},
+		PeriodSeconds:    10,
+		TimeoutSeconds:   5,
+		FailureThreshold: 3,
+	}
+	podinfoReadinessProbe = corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{Path: "/readyz", Port: intstr.FromString("http")},
+		},
+		PeriodSeconds:    10,
+		TimeoutSeconds:   5,
+		FailureThreshold: 3,
+	}
+	podinfoStartupProbe = corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("http")},
+		},
+		PeriodSeconds:    2,
+		TimeoutSeconds:   5,
+		FailureThreshold: 30,
+	}
+	redisLivenessProbe = corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("redis")},
+		},
+		PeriodSeconds:    10,
+		TimeoutSeconds:   5,
+		FailureThreshold: 3,
+	}
+	redisReadinessProbe = corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"sh", "-c", "redis-cli ping | grep -q PONG"}},
+		},
+		PeriodSeconds:    10,
+		TimeoutSeconds:   5,
+		FailureThreshold: 3,
+	}
+	redisStartupProbe = corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("redis")},
+		},
+		PeriodSeconds:    5,
+		TimeoutSeconds:   5,
+		FailureThreshold: 60,
+	}
+)
+
+// buildProbe returns probe tuned by settings, or nil if settings disable it.
+func buildProbe(probe corev1.Probe, settings *podinfov1alpha1.ProbeSettings) *corev1.Probe {
+	if settings == nil {
+		return &probe
+	}
+	if settings.Enabled != nil && !*settings.Enabled {
+		return nil
+	}
+	if settings.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = *settings.InitialDelaySeconds
+	}
+	if settings.PeriodSeconds != nil {
+		probe.PeriodSeconds = *settings.PeriodSeconds
+	}
+	if settings.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = *settings.TimeoutSeconds
+	}
+	if settings.FailureThreshold != nil {
+		probe.FailureThreshold = *settings.FailureThreshold
+	}
+	return &probe
+}
+
+// buildRedisPasswordEnv exposes the redis password to a container, sourced from its Secret.
+func buildRedisPasswordEnv(myApp *podinfov1alpha1.MyAppResource) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name:      redisPasswordEnv,
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: redisAuthSecretKeySelector(myApp)},
+	}
+}
+
+// buildIngress builds an ingress routing the configured hosts and paths to the http port of the podinfo service.
+func buildIngress(myApp *podinfov1alpha1.MyAppResource) *networkingv1.Ingress {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	spec := myApp.Spec.Ingress
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			Annotations:     maps.Clone(spec.Annotations),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: networkingv1.IngressSpec{IngressClassName: spec.ClassName},
+	}
+
+	backend := networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{
+			Name: myApp.Name,
+			Port: networkingv1.ServiceBackendPort{Name: "http"},
+		},
+	}
+	hosts := spec.Hosts
+	if len(hosts) == 0 {
+		// A rule without a host matches requests for any host.
+		hosts = []podinfov1alpha1.IngressHost{{}}
+	}
+	for _, host := range hosts {
+		paths := host.Paths
+		if len(paths) == 0 {
+			paths = []podinfov1alpha1.IngressPath{{}}
+		}
+		rule := networkingv1.IngressRule{
+			Host:             host.Host,
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{}},
+		}
+		for _, path := range paths {
+			pathType := path.PathType
+			if pathType == "" {
+				pathType = networkingv1.PathTypePrefix
+			}
+			httpPath := networkingv1.HTTPIngressPath{Path: path.Path, PathType: &pathType, Backend: backend}
+			if httpPath.Path == "" {
+				httpPath.Path = "/"
+			}
+			rule.HTTP.Paths = append(rule.HTTP.Paths, httpPath)
+		}
+		ingress.Spec.Rules = append(ingress.Spec.Rules, rule)
+	}
+	for _, tls := range spec.TLS {
+		ingress.Spec.TLS = append(ingress.Spec.TLS, networkingv1.IngressTLS{Hosts: tls.Hosts, SecretName: tls.SecretName})
+	}
+	return ingress
+}
+
+// buildNetworkPolicy builds a networkpolicy admitting the configured peers to the podinfo http and grpc ports, and
+// while monitoring, any peer to the metrics port.
+func buildNetworkPolicy(myApp *podinfov1alpha1.MyAppResource) *networkingv1.NetworkPolicy {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: selectorLabels(myApp)},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				Ports: buildNetworkPolicyPorts("http", "grpc"),
+				From:  myApp.Spec.NetworkPolicy.From,
+			}},
+		},
+	}
+	if myApp.Spec.Monitoring.Enabled {
+		np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: buildNetworkPolicyPorts("http-metrics"),
+		})
+	}
+	return np
+}
+
+// buildRedisNetworkPolicy builds a networkpolicy admitting only the podinfo pods of myApp to the Redis port.
+func buildRedisNetworkPolicy(myApp *podinfov1alpha1.MyAppResource) *networkingv1.NetworkPolicy {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name + redisNamePostfix,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app.kubernetes.io/name": myApp.Name + redisNamePostfix},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				Ports: buildNetworkPolicyPorts("redis"),
+				// A pod selector without a namespace selector only matches pods of the policy's own namespace.
+				From: []networkingv1.NetworkPolicyPeer{{
+					PodSelector: &metav1.LabelSelector{MatchLabels: selectorLabels(myApp)},
+				}},
+			}},
+		},
+	}
+}
+
+// buildNetworkPolicyPorts returns the named TCP container ports as networkpolicy ports.
+func buildNetworkPolicyPorts(names ...string) []networkingv1.NetworkPolicyPort {
+	ports := make([]networkingv1.NetworkPolicyPort, 0, len(names))
+	for _, name := range names {
+		protocol, port := corev1.ProtocolTCP, intstr.FromString(name)
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+	return ports
+}
+
+// buildHTTPRoute builds an HTTPRoute attaching the podinfo service's http port to the configured gateways.
+func buildHTTPRoute(myApp *podinfov1alpha1.MyAppResource) *gatewayv1.HTTPRoute {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	spec := myApp.Spec.Gateway
+	return &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: spec.ParentRefs},
+			Hostnames:       spec.Hostnames,
+			Rules: []gatewayv1.HTTPRouteRule{{
+				BackendRefs: []gatewayv1.HTTPBackendRef{{BackendRef: buildServiceBackendRef(myApp, 9898)}},
+			}},
+		},
+	}
+}
+
+// buildGRPCRoute builds a GRPCRoute attaching the podinfo service's grpc port to the configured gateways.
+func buildGRPCRoute(myApp *podinfov1alpha1.MyAppResource) *gatewayv1alpha2.GRPCRoute {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	spec := myApp.Spec.Gateway
+	return &gatewayv1alpha2.GRPCRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: gatewayv1alpha2.GRPCRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: spec.ParentRefs},
+			Hostnames:       spec.Hostnames,
+			Rules: []gatewayv1alpha2.GRPCRouteRule{{
+				BackendRefs: []gatewayv1alpha2.GRPCBackendRef{{BackendRef: buildServiceBackendRef(myApp, 9999)}},
+			}},
+		},
+	}
+}
+
+// buildServiceBackendRef references a port of the podinfo service. Routes reference service ports by number.
+func buildServiceBackendRef(myApp *podinfov1alpha1.MyAppResource, port gatewayv1.PortNumber) gatewayv1.BackendRef {
+	return gatewayv1.BackendRef{
+		BackendObjectReference: gatewayv1.BackendObjectReference{
+			Name: gatewayv1.ObjectName(myApp.Name),
+			Port: &port,
+		},
+	}
+}
+
+// buildServiceMonitor builds a servicemonitor scraping the metrics port of the podinfo service.
+func buildServiceMonitor(myApp *podinfov1alpha1.MyAppResource) *monitoringv1.ServiceMonitor {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	monitoring := myApp.Spec.Monitoring
+	return &monitoringv1.ServiceMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          buildMonitorLabels(myApp, myApp.Spec.Monitoring.Labels),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: monitoringv1.ServiceMonitorSpec{
+			Endpoints: []monitoringv1.Endpoint{{
+				Port:          "http-metrics",
+				Path:          "/metrics",
+				Interval:      monitoring.Interval,
+				ScrapeTimeout: monitoring.ScrapeTimeout,
+			}},
+			// The Redis Services carry the same label, but expose no http-metrics port to scrape.
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			},
+		},
+	}
+}
+
+// buildPodMonitor builds a podmonitor scraping the metrics port of the podinfo pods.
+func buildPodMonitor(myApp *podinfov1alpha1.MyAppResource) *monitoringv1.PodMonitor {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	monitoring := myApp.Spec.Monitoring
+	return &monitoringv1.PodMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          buildMonitorLabels(myApp, myApp.Spec.Monitoring.Labels),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: monitoringv1.PodMonitorSpec{
+			PodMetricsEndpoints: []monitoringv1.PodMetricsEndpoint{{
+				Port:          "http-metrics",
+				Path:          "/metrics",
+				Interval:      monitoring.Interval,
+				ScrapeTimeout: monitoring.ScrapeTimeout,
+			}},
+			Selector: metav1.LabelSelector{MatchLabels: selectorLabels(myApp)},
+		},
+	}
+}
+
+// buildMonitorLabels returns the configured labels of a monitor or rule along with the MyAppResource label.
+func buildMonitorLabels(myApp *podinfov1alpha1.MyAppResource, configured map[string]string) map[string]string {
+	labels := map[string]string{}
+	for k, v := range configured {
+		labels[k] = v
+	}
+	labels[podinfov1alpha1.MyAppResourceLabelName] = myApp.Name
+	return labels
+}
+
+// buildPrometheusRule builds a prometheusrule with the default podinfo alerts. The podinfo and Redis alerts read
+// kube-state-metrics, the error rate alert the http_requests_total counter of the scraped podinfo pods. Every alert is
+// labelled with the MyAppResource name and namespace.
+func buildPrometheusRule(myApp *podinfov1alpha1.MyAppResource) *monitoringv1.PrometheusRule {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	alerting := myApp.Spec.Alerting
+	deployment := fmt.Sprintf(`namespace="%s",deployment="%s"`, myApp.Namespace, myApp.Name)
+	type alert struct {
+		name, expr, severity, summary string
+	}
+	alerts := []alert{
+		{
+			"PodinfoUnavailable",
+			fmt.Sprintf(`kube_deployment_status_replicas_available{%s} == 0`, deployment),
+			"critical",
+			"podinfo has no available replicas.",
+		},
+		{
+			"PodinfoReplicasBelowDesired",
+			fmt.Sprintf(`kube_deployment_status_replicas_available{%s} < kube_deployment_spec_replicas{%s}`,
+				deployment, deployment),
+			"warning",
+			"podinfo has fewer available replicas than desired.",
+		},
+	}
+	if alerting.ErrorRatePercent != nil {
+		// Only the podinfo pods are matched, not those of the Redis Deployment named after the MyAppResource too.
+		requests := fmt.Sprintf(`http_requests_total{namespace="%s",pod=~"%s-[a-z0-9]+-[a-z0-9]+"`,
+			myApp.Namespace, myApp.Name)
+		alerts = append(alerts, alert{
+			"PodinfoHighErrorRate",
+			fmt.Sprintf(`100 * sum(rate(%s,status=~"5.."}[5m])) / sum(rate(%s}[5m])) > %d`,
+				requests, requests, *alerting.ErrorRatePercent),
+			"warning",
+			fmt.Sprintf("podinfo answers more than %d%% of requests with a 5xx.", *alerting.ErrorRatePercent),
+		})
+	}
+	if myApp.Spec.Redis.Enabled && redisExternal(myApp) == nil {
+		redisReady := fmt.Sprintf(`kube_deployment_status_replicas_available{namespace="%s",deployment="%s"}`,
+			myApp.Namespace, myApp.Name+redisNamePostfix)
+		if myApp.Spec.Redis.Persistence.Enabled {
+			redisReady = fmt.Sprintf(`kube_statefulset_status_replicas_ready{namespace="%s",statefulset="%s"}`,
+				myApp.Namespace, myApp.Name+redisNamePostfix)
+		}
+		alerts = append(alerts, alert{
+			"PodinfoRedisDown", redisReady + " == 0", "critical", "The podinfo Redis is down.",
+		})
+	}
+
+	var forDuration *monitoringv1.Duration
+	if alerting.For != "" {
+		forDuration = &alerting.For
+	}
+	rules := make([]monitoringv1.Rule, 0, len(alerts))
+	for _, a := range alerts {
+		rules = append(rules, monitoringv1.Rule{
+			Alert: a.name,
+			Expr:  intstr.FromString(a.expr),
+			For:   forDuration,
+			Labels: map[string]string{
+				alertNameLabel:      myApp.Name,
+				alertNamespaceLabel: myApp.Namespace,
+				"severity":          a.severity,
+			},
+			Annotations: map[string]string{
+				"summary": fmt.Sprintf("%s/%s: %s", myApp.Namespace, myApp.Name, a.summary),
+			},
+		})
+	}
+	return &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          buildMonitorLabels(myApp, alerting.Labels),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: monitoringv1.PrometheusRuleSpec{
+			Groups: []monitoringv1.RuleGroup{{Name: "podinfo", Rules: rules}},
+		},
+	}
+}
+
+// buildHorizontalPodAutoscaler builds an autoscaling/v2 HorizontalPodAutoscaler scaling the podinfo deployment.
+func buildHorizontalPodAutoscaler(myApp *podinfov1alpha1.MyAppResource) *autoscalingv2.HorizontalPodAutoscaler {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	autoscaling := myApp.Spec.Autoscaling
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       myApp.Name,
+			},
+			MinReplicas: autoscaling.MinReplicas,
+			MaxReplicas: autoscaling.MaxReplicas,
+			Behavior:    autoscaling.Behavior,
+		},
+	}
+	targets := []struct {
+		resource    corev1.ResourceName
+		utilization *int32
+	}{
+		{corev1.ResourceCPU, autoscaling.TargetCPUUtilizationPercentage},
+		{corev1.ResourceMemory, autoscaling.TargetMemoryUtilizationPercentage},
+	}
+	for _, target := range targets {
+		if target.utilization == nil {
+			continue
+		}
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: target.resource,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: target.utilization,
+				},
+			},
+		})
+	}
+	return hpa
+}
+
+// buildPodDisruptionBudget builds a policy/v1 PodDisruptionBudget for the podinfo pods.
+func buildPodDisruptionBudget(myApp *podinfov1alpha1.MyAppResource) *policyv1.PodDisruptionBudget {
+	ownerGVK := schema.GroupVersionKind{Group: "podinfo.podinfo.com", Version: "v1alpha1", Kind: "MyAppResource"}
+	disruption := myApp.Spec.Disruption
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myApp.Name,
+			Namespace:       myApp.Namespace,
+			Labels:          map[string]string{podinfov1alpha1.MyAppResourceLabelName: myApp.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(myApp, ownerGVK)},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable:   disruption.MinAvailable,
+			MaxUnavailable: disruption.MaxUnavailable,
+			Selector:       &metav1.LabelSelector{MatchLabels: selectorLabels(myApp)},
+		},
+	}
+	if pdb.Spec.MinAvailable == nil && pdb.Spec.MaxUnavailable == nil {
+		maxUnavailable := podinfov1alpha1.DefaultMaxUnavailable
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	}
+	return pdb
+}
+
+// buildResourceRequirements converts a Resources spec to container resource requirements. Only the quantities given
+// are set, so the API server can still default the memory request to the memory limit.
+func buildResourceRequirements(resources podinfov1alpha1.Resources) corev1.ResourceRequirements {
+	requirements := corev1.ResourceRequirements{}
+	if !resources.MemoryLimit.IsZero() {
+		requirements.Limits = corev1.ResourceList{corev1.ResourceMemory: resources.MemoryLimit}
+	}
+	if !resources.CPURequest.IsZero() {
+		requirements.Requests = corev1.ResourceList{corev1.ResourceCPU: resources.CPURequest}
+	}
+	if !resources.MemoryRequest.IsZero() {
+		if requirements.Requests == nil {
+			requirements.Requests = corev1.ResourceList{}
+		}
+		requirements.Requests[corev1.ResourceMemory] = resources.MemoryRequest
+	}
+	return requirements
 }
@@ -19,9 +19,14 @@ package controller
 import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
 )
@@ -60,10 +65,350 @@ var _ = Describe("MyAppResource Controller Support Functions", func() {
 		Expect(d.Spec.Template.Spec.Containers[0].Name).To(Equal("podinfo"))
 		Expect(d.Name).To(Equal(myappresource.Name))
 		Expect(d.Namespace).To(Equal(myappresource.Namespace))
+		Expect(d.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:latest"))
+	})
+
+	It("should run the default podinfo repository when none is set", func() {
+		// Without the webhook, the repository is not defaulted in the stored object.
+		undefaulted := myappresource.DeepCopy()
+		undefaulted.Spec.Image.Repository = ""
+		container := buildDeployment(undefaulted).Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal(podinfov1alpha1.DefaultImageRepository + ":latest"))
 	})
 
 	It("should successfully build a matching service", func() {
 		d := buildService(myappresource)
 		Expect(d.Spec.Ports[0].Port).To(Equal(int32(9898)))
 	})
+
+	It("should build every resource in the myappresource's namespace", func() {
+		inTeamNS := myappresource.DeepCopy()
+		inTeamNS.Namespace = "team-a"
+		Expect(buildDeployment(inTeamNS).Namespace).To(Equal("team-a"))
+		Expect(buildService(inTeamNS).Namespace).To(Equal("team-a"))
+		Expect(buildRedisDeployment(inTeamNS).Namespace).To(Equal("team-a"))
+		Expect(buildRedisService(inTeamNS).Namespace).To(Equal("team-a"))
+	})
+	It("should build an autoscaler and leave the deployment's replicas to it while autoscaling", func() {
+		autoscaled := myappresource.DeepCopy()
+		autoscaled.Spec.Autoscaling = podinfov1alpha1.Autoscaling{
+			Enabled:                           true,
+			MinReplicas:                       ptr(int32(2)),
+			MaxReplicas:                       10,
+			TargetMemoryUtilizationPercentage: ptr(int32(75)),
+		}
+		Expect(buildDeployment(autoscaled).Spec.Replicas).To(BeNil())
+		Expect(buildDeployment(myappresource).Spec.Replicas).To(Equal(ptr(int32(3))))
+
+		hpa := buildHorizontalPodAutoscaler(autoscaled)
+		Expect(hpa.Spec.ScaleTargetRef.Kind).To(Equal("Deployment"))
+		Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal(resourceName))
+		Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+		Expect(hpa.Spec.MaxReplicas).To(Equal(int32(10)))
+		Expect(hpa.Spec.Metrics).To(HaveLen(1))
+		Expect(hpa.Spec.Metrics[0].Resource.Name).To(Equal(corev1.ResourceMemory))
+		Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(75)))
+	})
+	It("should run a single redis instance of the configured image", func() {
+		redisDep := buildRedisDeployment(myappresource)
+		Expect(*redisDep.Spec.Replicas).To(Equal(int32(1)))
+		Expect(redisDep.Spec.Strategy.RollingUpdate.MaxSurge.IntValue()).To(BeZero())
+		Expect(redisDep.Spec.Template.Spec.Containers[0].Image).To(Equal("redis:7.2.4-alpine3.19"))
+
+		customImage := myappresource.DeepCopy()
+		customImage.Spec.Redis.Image = &podinfov1alpha1.Image{
+			Repository: "registry.example.com/redis",
+			Tag:        "7.2.5",
+			PullPolicy: corev1.PullAlways,
+		}
+		container := buildRedisDeployment(customImage).Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("registry.example.com/redis:7.2.5"))
+		Expect(container.ImagePullPolicy).To(Equal(corev1.PullAlways))
+	})
+	It("should build a persistent redis statefulset and its headless service", func() {
+		persistent := myappresource.DeepCopy()
+		persistent.Spec.Redis.Persistence = podinfov1alpha1.RedisPersistence{
+			Enabled:          true,
+			StorageClassName: ptr("fast"),
+			Size:             resource.MustParse("2Gi"),
+			Mode:             podinfov1alpha1.RedisPersistenceRDB,
+		}
+
+		sts := buildRedisStatefulSet(persistent)
+		Expect(sts.Name).To(Equal(resourceName + redisNamePostfix))
+		Expect(sts.Spec.ServiceName).To(Equal(resourceName + redisHeadlessNamePostfix))
+		Expect(sts.Spec.Template.Labels).To(Equal(buildRedisDeployment(persistent).Spec.Template.Labels))
+		Expect(sts.Spec.VolumeClaimTemplates).To(HaveLen(1))
+		claim := sts.Spec.VolumeClaimTemplates[0]
+		Expect(*claim.Spec.StorageClassName).To(Equal("fast"))
+		Expect(claim.Spec.Resources.Requests.Storage().String()).To(Equal("2Gi"))
+		container := sts.Spec.Template.Spec.Containers[0]
+		Expect(container.VolumeMounts).To(ConsistOf(corev1.VolumeMount{Name: claim.Name, MountPath: "/data"}))
+		Expect(container.Args).To(ContainElements("--appendonly", "no", "--save"))
+
+		persistent.Spec.Redis.Persistence.Mode = podinfov1alpha1.RedisPersistenceAOF
+		Expect(buildRedisStatefulSet(persistent).Spec.Template.Spec.Containers[0].Args).
+			To(Equal([]string{"--appendonly", "yes"}))
+
+		headless := buildRedisHeadlessService(persistent)
+		Expect(headless.Name).To(Equal(sts.Spec.ServiceName))
+		Expect(headless.Spec.ClusterIP).To(Equal(corev1.ClusterIPNone))
+		Expect(headless.Spec.Selector).To(Equal(sts.Spec.Template.Labels))
+	})
+	It("should source the redis password from its secret in both containers", func() {
+		authenticated := myappresource.DeepCopy()
+		authenticated.Spec.Redis.Auth = podinfov1alpha1.RedisAuth{Enabled: true}
+
+		env := buildDeployment(authenticated).Spec.Template.Spec.Containers[0].Env
+		Expect(env).To(ContainElement(corev1.EnvVar{
+			Name: redisPasswordEnv,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: resourceName + redisAuthNamePostfix},
+				Key:                  "password",
+			}},
+		}))
+		// The password must be defined before the cache server URL expanding it.
+		Expect(env[len(env)-1]).To(Equal(corev1.EnvVar{
+			Name:  "PODINFO_CACHE_SERVER",
+			Value: "tcp://:$(REDIS_PASSWORD)@test-resource-redis.default.svc.cluster.local:6379",
+		}))
+
+		authenticated.Spec.Redis.Auth.SecretRef = &podinfov1alpha1.SecretKeyReference{Name: "redis", Key: "pass"}
+		redis := buildRedisDeployment(authenticated).Spec.Template.Spec.Containers[0]
+		Expect(redis.Env[0].ValueFrom.SecretKeyRef.Name).To(Equal("redis"))
+		Expect(redis.Env[0].ValueFrom.SecretKeyRef.Key).To(Equal("pass"))
+		Expect(redis.Args).To(Equal([]string{"--requirepass", "$(REDIS_PASSWORD)"}))
+
+		authenticated.Spec.Redis.Persistence = podinfov1alpha1.RedisPersistence{Enabled: true}
+		Expect(buildRedisStatefulSet(authenticated).Spec.Template.Spec.Containers[0].Args).
+			To(Equal([]string{"--appendonly", "yes", "--requirepass", "$(REDIS_PASSWORD)"}))
+	})
+	It("should point podinfo at an external redis", func() {
+		external := myappresource.DeepCopy()
+		external.Spec.Redis.External = &podinfov1alpha1.RedisExternal{Address: "cache.example.com"}
+		Expect(buildRedisCacheServer(external)).To(Equal("tcp://cache.example.com:6379"))
+
+		external.Spec.Redis.External = &podinfov1alpha1.RedisExternal{
+			Address:   "10.0.0.7",
+			Port:      6380,
+			TLS:       true,
+			SecretRef: &podinfov1alpha1.SecretKeyReference{Name: "managed-redis", Key: "token"},
+		}
+		// Auth options of the operator's own redis do not apply to an external one.
+		external.Spec.Redis.Auth = podinfov1alpha1.RedisAuth{Enabled: false}
+
+		env := buildDeployment(external).Spec.Template.Spec.Containers[0].Env
+		Expect(env[len(env)-2].ValueFrom.SecretKeyRef).To(Equal(&corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "managed-redis"},
+			Key:                  "token",
+		}))
+		Expect(env[len(env)-1].Value).To(Equal("rediss://:$(REDIS_PASSWORD)@10.0.0.7:6380"))
+	})
+	It("should probe the podinfo and redis containers", func() {
+		podinfo := buildDeployment(myappresource).Spec.Template.Spec.Containers[0]
+		Expect(podinfo.LivenessProbe.HTTPGet.Path).To(Equal("/healthz"))
+		Expect(podinfo.ReadinessProbe.HTTPGet.Path).To(Equal("/readyz"))
+		Expect(podinfo.StartupProbe.HTTPGet.Port).To(Equal(intstr.FromString("http")))
+
+		redis := buildRedisDeployment(myappresource).Spec.Template.Spec.Containers[0]
+		Expect(redis.LivenessProbe.TCPSocket.Port).To(Equal(intstr.FromString("redis")))
+		Expect(redis.ReadinessProbe.Exec.Command).To(ContainElement(ContainSubstring("redis-cli ping")))
+		Expect(redis.StartupProbe).NotTo(BeNil())
+
+		By("tuning and disabling probes from the spec")
+		tuned := myappresource.DeepCopy()
+		tuned.Spec.Probes = podinfov1alpha1.Probes{
+			Readiness: &podinfov1alpha1.ProbeSettings{PeriodSeconds: ptr(int32(3)), FailureThreshold: ptr(int32(1))},
+			Startup:   &podinfov1alpha1.ProbeSettings{Enabled: ptr(false)},
+		}
+		tuned.Spec.Redis.Probes.Liveness = &podinfov1alpha1.ProbeSettings{InitialDelaySeconds: ptr(int32(15))}
+
+		podinfo = buildDeployment(tuned).Spec.Template.Spec.Containers[0]
+		Expect(podinfo.ReadinessProbe.PeriodSeconds).To(Equal(int32(3)))
+		Expect(podinfo.ReadinessProbe.FailureThreshold).To(Equal(int32(1)))
+		Expect(podinfo.ReadinessProbe.TimeoutSeconds).To(Equal(podinfoReadinessProbe.TimeoutSeconds))
+		Expect(podinfo.StartupProbe).To(BeNil())
+		Expect(podinfoReadinessProbe.PeriodSeconds).To(Equal(int32(10)), "the defaults must not be modified")
+
+		redis = buildRedisDeployment(tuned).Spec.Template.Spec.Containers[0]
+		Expect(redis.LivenessProbe.InitialDelaySeconds).To(Equal(int32(15)))
+		Expect(redis.LivenessProbe.TCPSocket).NotTo(BeNil())
+	})
+	It("should budget disruptions of the podinfo pods", func() {
+		pdb := buildPodDisruptionBudget(myappresource)
+		Expect(pdb.Spec.Selector.MatchLabels).To(Equal(buildDeployment(myappresource).Spec.Template.Labels))
+		Expect(pdb.Spec.MaxUnavailable).To(Equal(&podinfov1alpha1.DefaultMaxUnavailable))
+		Expect(pdb.Spec.MinAvailable).To(BeNil())
+
+		budgeted := myappresource.DeepCopy()
+		budgeted.Spec.Disruption.MinAvailable = ptr(intstr.FromInt32(2))
+		pdb = buildPodDisruptionBudget(budgeted)
+		Expect(pdb.Spec.MinAvailable).To(Equal(ptr(intstr.FromInt32(2))))
+		Expect(pdb.Spec.MaxUnavailable).To(BeNil())
+	})
+	It("should admit only the podinfo pods to redis, and the configured peers to podinfo", func() {
+		redisPolicy := buildRedisNetworkPolicy(myappresource)
+		Expect(redisPolicy.Spec.PodSelector.MatchLabels).To(Equal(
+			buildRedisDeployment(myappresource).Spec.Template.Labels))
+		Expect(redisPolicy.Spec.Ingress).To(HaveLen(1))
+		Expect(redisPolicy.Spec.Ingress[0].From).To(HaveLen(1))
+		Expect(redisPolicy.Spec.Ingress[0].From[0].NamespaceSelector).To(BeNil())
+		Expect(redisPolicy.Spec.Ingress[0].From[0].PodSelector.MatchLabels).To(Equal(
+			buildDeployment(myappresource).Spec.Template.Labels))
+		Expect(redisPolicy.Spec.Ingress[0].Ports[0].Port.String()).To(Equal("redis"))
+
+		isolated := myappresource.DeepCopy()
+		isolated.Spec.NetworkPolicy.From = []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"kubernetes.io/metadata.name": "ingress-nginx"},
+			},
+		}}
+		policy := buildNetworkPolicy(isolated)
+		Expect(policy.Spec.PodSelector.MatchLabels).To(Equal(buildDeployment(isolated).Spec.Template.Labels))
+		Expect(policy.Spec.Ingress).To(HaveLen(1))
+		Expect(policy.Spec.Ingress[0].From).To(Equal(isolated.Spec.NetworkPolicy.From))
+		Expect(policy.Spec.Ingress[0].Ports).To(HaveLen(2))
+
+		isolated.Spec.Monitoring.Enabled = true
+		policy = buildNetworkPolicy(isolated)
+		Expect(policy.Spec.Ingress).To(HaveLen(2))
+		Expect(policy.Spec.Ingress[1].From).To(BeEmpty())
+		Expect(policy.Spec.Ingress[1].Ports[0].Port.String()).To(Equal("http-metrics"))
+	})
+	It("should label every child with its myappresource", func() {
+		everything := myappresource.DeepCopy()
+		everything.Spec.Redis.Persistence.Enabled = true
+		everything.Spec.Ingress = &podinfov1alpha1.Ingress{}
+		everything.Spec.Gateway = &podinfov1alpha1.Gateway{ParentRefs: []gatewayv1.ParentReference{{Name: "public"}}}
+		children := []metav1.Object{
+			buildDeployment(everything),
+			buildService(everything),
+			buildRedisDeployment(everything),
+			buildRedisStatefulSet(everything),
+			buildRedisService(everything),
+			buildRedisHeadlessService(everything),
+			buildHorizontalPodAutoscaler(everything),
+			buildPodDisruptionBudget(everything),
+			buildNetworkPolicy(everything),
+			buildRedisNetworkPolicy(everything),
+			buildIngress(everything),
+			buildHTTPRoute(everything),
+			buildGRPCRoute(everything),
+			buildServiceMonitor(everything),
+			buildPodMonitor(everything),
+			buildPrometheusRule(everything),
+		}
+		for _, child := range children {
+			Expect(child.GetLabels()).To(HaveKeyWithValue(podinfov1alpha1.MyAppResourceLabelName, resourceName),
+				"%T %s", child, child.GetName())
+		}
+	})
+	It("should route every ingress host and path to the podinfo http port", func() {
+		exposed := myappresource.DeepCopy()
+		exposed.Spec.Ingress = &podinfov1alpha1.Ingress{}
+		rules := buildIngress(exposed).Spec.Rules
+		Expect(rules).To(HaveLen(1))
+		Expect(rules[0].Host).To(BeEmpty())
+		Expect(rules[0].HTTP.Paths[0].Path).To(Equal("/"))
+		Expect(*rules[0].HTTP.Paths[0].PathType).To(Equal(networkingv1.PathTypePrefix))
+
+		exposed.Spec.Ingress.Hosts = []podinfov1alpha1.IngressHost{
+			{Host: "a.example.com"},
+			{Host: "b.example.com", Paths: []podinfov1alpha1.IngressPath{
+				{Path: "/api", PathType: networkingv1.PathTypeExact},
+				{Path: "/ui"},
+			}},
+		}
+		rules = buildIngress(exposed).Spec.Rules
+		Expect(rules).To(HaveLen(2))
+		Expect(rules[1].Host).To(Equal("b.example.com"))
+		Expect(rules[1].HTTP.Paths).To(HaveLen(2))
+		Expect(*rules[1].HTTP.Paths[0].PathType).To(Equal(networkingv1.PathTypeExact))
+		Expect(*rules[1].HTTP.Paths[1].PathType).To(Equal(networkingv1.PathTypePrefix))
+		Expect(rules[1].HTTP.Paths[1].Backend.Service.Port.Name).To(Equal("http"))
+	})
+	It("should copy the ingress annotations rather than share them with the spec", func() {
+		annotated := myappresource.DeepCopy()
+		annotated.Spec.Ingress = &podinfov1alpha1.Ingress{
+			Annotations: map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "false"},
+		}
+		ingress := buildIngress(annotated)
+		Expect(ingress.Annotations).To(Equal(annotated.Spec.Ingress.Annotations))
+		ingress.Annotations["example.com/extra"] = "true"
+		Expect(annotated.Spec.Ingress.Annotations).NotTo(HaveKey("example.com/extra"))
+	})
+	It("should route the podinfo http and grpc ports through the gateway", func() {
+		routed := myappresource.DeepCopy()
+		routed.Spec.Gateway = &podinfov1alpha1.Gateway{
+			ParentRefs: []gatewayv1.ParentReference{{Name: "public"}},
+			Hostnames:  []gatewayv1.Hostname{"podinfo.example.com"},
+		}
+
+		httpRoute := buildHTTPRoute(routed)
+		Expect(httpRoute.Spec.ParentRefs).To(Equal(routed.Spec.Gateway.ParentRefs))
+		Expect(httpRoute.Spec.Hostnames).To(Equal(routed.Spec.Gateway.Hostnames))
+		backend := httpRoute.Spec.Rules[0].BackendRefs[0]
+		Expect(backend.Name).To(Equal(gatewayv1.ObjectName(resourceName)))
+		Expect(*backend.Port).To(Equal(gatewayv1.PortNumber(9898)))
+
+		grpcBackend := buildGRPCRoute(routed).Spec.Rules[0].BackendRefs[0]
+		Expect(grpcBackend.Name).To(Equal(gatewayv1.ObjectName(resourceName)))
+		Expect(*grpcBackend.Port).To(Equal(gatewayv1.PortNumber(9999)))
+	})
+	It("should expose and scrape the podinfo metrics port while monitoring", func() {
+		Expect(buildService(myappresource).Spec.Ports).To(HaveLen(2))
+
+		monitored := myappresource.DeepCopy()
+		monitored.Spec.Monitoring = podinfov1alpha1.Monitoring{
+			Enabled:  true,
+			Interval: "15s",
+			Labels:   map[string]string{"release": "prometheus"},
+		}
+		ports := buildService(monitored).Spec.Ports
+		Expect(ports).To(HaveLen(3))
+		Expect(ports[2].Name).To(Equal("http-metrics"))
+		Expect(ports[2].Port).To(Equal(int32(9797)))
+
+		serviceMonitor := buildServiceMonitor(monitored)
+		Expect(serviceMonitor.Labels).To(HaveKeyWithValue("release", "prometheus"))
+		Expect(serviceMonitor.Labels).To(HaveKeyWithValue(podinfov1alpha1.MyAppResourceLabelName, resourceName))
+		Expect(serviceMonitor.Spec.Selector.MatchLabels).To(Equal(map[string]string{
+			podinfov1alpha1.MyAppResourceLabelName: resourceName,
+		}))
+		Expect(serviceMonitor.Spec.Endpoints[0].Port).To(Equal("http-metrics"))
+		Expect(serviceMonitor.Spec.Endpoints[0].Interval).To(Equal(monitoringv1.Duration("15s")))
+
+		podMonitor := buildPodMonitor(monitored)
+		Expect(podMonitor.Spec.Selector.MatchLabels).To(Equal(selectorLabels(monitored)))
+		Expect(podMonitor.Spec.PodMetricsEndpoints[0].Port).To(Equal("http-metrics"))
+	})
+	It("should render the podinfo alerts labelled with the myappresource", func() {
+		alerted := myappresource.DeepCopy()
+		alerted.Spec.Alerting = podinfov1alpha1.Alerting{
+			Enabled:          true,
+			ErrorRatePercent: ptr(int32(10)),
+			For:              "10m",
+			Labels:           map[string]string{"role": "alert-rules"},
+		}
+		rule := buildPrometheusRule(alerted)
+		Expect(rule.Labels).To(HaveKeyWithValue("role", "alert-rules"))
+		rules := rule.Spec.Groups[0].Rules
+		Expect(rules).To(HaveLen(4))
+		for _, r := range rules {
+			Expect(r.Labels).To(HaveKeyWithValue("myappresource", resourceName))
+			Expect(r.Labels).To(HaveKeyWithValue("namespace", "default"))
+			Expect(*r.For).To(Equal(monitoringv1.Duration("10m")))
+		}
+		Expect(rules[2].Alert).To(Equal("PodinfoHighErrorRate"))
+		Expect(rules[2].Expr.String()).To(HaveSuffix("> 10"))
+		Expect(rules[3].Alert).To(Equal("PodinfoRedisDown"))
+		Expect(rules[3].Expr.String()).To(ContainSubstring(`deployment="` + resourceName + redisNamePostfix + `"`))
+
+		alerted.Spec.Redis.Persistence.Enabled = true
+		Expect(buildPrometheusRule(alerted).Spec.Groups[0].Rules[3].Expr.String()).To(
+			ContainSubstring(`statefulset="` + resourceName + redisNamePostfix + `"`))
+
+		alerted.Spec.Redis.External = &podinfov1alpha1.RedisExternal{Address: "cache.example.com", Port: 6379}
+		Expect(buildPrometheusRule(alerted).Spec.Groups[0].Rules).To(HaveLen(3))
+	})
 })
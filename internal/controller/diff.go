@@ -0,0 +1,151 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// appliedHashAnnotation records a hash of the desired state last applied to a child resource. A changed hash means
+// the desired state changed, which also catches fields the operator stopped setting.
+const appliedHashAnnotation = "myappresource.podinfo.podinfo.com/applied-hash"
+
+// desiredHash returns a stable hash of the desired object.
+func desiredHash(desired client.Object) (string, error) {
+	raw, err := json.Marshal(desired)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// needsApply reports whether applying desired would change observed. desired must carry its appliedHashAnnotation.
+//
+// Only the fields present in desired are compared, so fields defaulted by the API server or set by other managers
+// never count as a difference.
+func needsApply(desired, observed client.Object) (bool, error) {
+	if observed.GetAnnotations()[appliedHashAnnotation] != desired.GetAnnotations()[appliedHashAnnotation] {
+		return true, nil
+	}
+
+	desiredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return false, err
+	}
+	observedMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(observed)
+	if err != nil {
+		return false, err
+	}
+	// Status is never applied, and the type was already matched when observed was read.
+	delete(desiredMap, "status")
+	delete(desiredMap, "apiVersion")
+	delete(desiredMap, "kind")
+	return !isSubset(desiredMap, observedMap), nil
+}
+
+// isSubset reports whether every value set in desired is set to the same value in observed.
+//
+// Nil values and empty maps or lists in desired set nothing. Lists whose items all carry a "name" (containers, env,
+// ports, volumes...) or a "uid" (owner references) are matched by that key, so items added by other managers are
+// ignored; any other list is compared item by item.
+func isSubset(desired, observed interface{}) bool {
+	switch desiredVal := desired.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		if len(desiredVal) == 0 {
+			return true
+		}
+		observedVal, ok := observed.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range desiredVal {
+			if !isSubset(value, observedVal[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		if len(desiredVal) == 0 {
+			return true
+		}
+		observedVal, ok := observed.([]interface{})
+		if !ok {
+			return false
+		}
+		if key := listMapKey(desiredVal); key != "" {
+			return isKeyedListSubset(key, desiredVal, observedVal)
+		}
+		if len(desiredVal) != len(observedVal) {
+			return false
+		}
+		for i := range desiredVal {
+			if !isSubset(desiredVal[i], observedVal[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(desired, observed)
+	}
+}
+
+// listMapKey returns the key every item of the list is identified by, or "" if the list is not keyed.
+func listMapKey(list []interface{}) string {
+	for _, key := range []string{"name", "uid"} {
+		keyed := true
+		for _, item := range list {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				return ""
+			}
+			if _, ok := itemMap[key]; !ok {
+				keyed = false
+				break
+			}
+		}
+		if keyed {
+			return key
+		}
+	}
+	return ""
+}
+
+// isKeyedListSubset reports whether every desired item is a subset of the observed item with the same key.
+func isKeyedListSubset(key string, desired, observed []interface{}) bool {
+	observedByKey := make(map[interface{}]interface{}, len(observed))
+	for _, item := range observed {
+		if itemMap, ok := item.(map[string]interface{}); ok {
+			observedByKey[itemMap[key]] = item
+		}
+	}
+	for _, item := range desired {
+		observedItem, ok := observedByKey[item.(map[string]interface{})[key]]
+		if !ok || !isSubset(item, observedItem) {
+			return false
+		}
+	}
+	return true
+}
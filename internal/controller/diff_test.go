@@ -0,0 +1,213 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// writeCountingClient counts every write issued through it, status writes included.
+type writeCountingClient struct {
+	client.Client
+	writes int
+}
+
+func (c *writeCountingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.writes++
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *writeCountingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.writes++
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *writeCountingClient) Patch(
+	ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption,
+) error {
+	c.writes++
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *writeCountingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.writes++
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *writeCountingClient) Status() client.SubResourceWriter {
+	return &writeCountingStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+type writeCountingStatusWriter struct {
+	client.SubResourceWriter
+	client *writeCountingClient
+}
+
+func (w *writeCountingStatusWriter) Update(
+	ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption,
+) error {
+	w.client.writes++
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *writeCountingStatusWriter) Patch(
+	ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption,
+) error {
+	w.client.writes++
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
+
+var _ = Describe("MyAppResource Semantic Diff", func() {
+	Context("When comparing desired and observed objects", func() {
+		It("should ignore fields only present in the observed object", func() {
+			desired := map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":              "test-resource",
+					"creationTimestamp": nil,
+					"labels":            map[string]interface{}{"app": "podinfo"},
+				},
+				"spec": map[string]interface{}{"strategy": map[string]interface{}{}},
+			}
+			observed := map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":              "test-resource",
+					"creationTimestamp": "2024-01-01T00:00:00Z",
+					"labels":            map[string]interface{}{"app": "podinfo", "team": "platform"},
+				},
+				"spec": map[string]interface{}{
+					"strategy":                map[string]interface{}{"type": "RollingUpdate"},
+					"progressDeadlineSeconds": int64(600),
+				},
+			}
+			Expect(isSubset(desired, observed)).To(BeTrue())
+
+			observed["metadata"].(map[string]interface{})["labels"] = map[string]interface{}{"app": "other"}
+			Expect(isSubset(desired, observed)).To(BeFalse())
+		})
+
+		It("should match named list items by name regardless of extra or reordered items", func() {
+			desired := []interface{}{
+				map[string]interface{}{"name": "podinfo", "image": "podinfo:latest"},
+			}
+			observed := []interface{}{
+				map[string]interface{}{"name": "sidecar", "image": "busybox"},
+				map[string]interface{}{"name": "podinfo", "image": "podinfo:latest", "imagePullPolicy": "Always"},
+			}
+			Expect(isSubset(desired, observed)).To(BeTrue())
+
+			desired[0].(map[string]interface{})["image"] = "podinfo:6.5.4"
+			Expect(isSubset(desired, observed)).To(BeFalse())
+		})
+
+		It("should compare unkeyed lists item by item", func() {
+			Expect(isSubset([]interface{}{"a", "b"}, []interface{}{"a", "b"})).To(BeTrue())
+			Expect(isSubset([]interface{}{"a", "b"}, []interface{}{"b", "a"})).To(BeFalse())
+			Expect(isSubset([]interface{}{"a"}, []interface{}{"a", "b"})).To(BeFalse())
+		})
+
+		It("should require an apply when the applied hash differs", func() {
+			desired := buildService(&podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-resource", Namespace: "default"},
+			})
+			observed := desired.DeepCopy()
+			desired.Annotations = map[string]string{appliedHashAnnotation: "new"}
+			observed.Annotations = map[string]string{appliedHashAnnotation: "old"}
+			Expect(needsApply(desired, observed)).To(BeTrue())
+
+			observed.Annotations[appliedHashAnnotation] = "new"
+			Expect(needsApply(desired, observed)).To(BeFalse())
+		})
+	})
+
+	Context("When reconciling an unchanged resource", func() {
+		const (
+			resourceName = "no-op-resource"
+			namespace    = "no-op"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(2)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Resources: podinfov1alpha1.Resources{
+						CPURequest:  resource.MustParse("100m"),
+						MemoryLimit: resource.MustParse("64Mi"),
+					},
+					Redis: podinfov1alpha1.Redis{Enabled: true},
+				},
+			})).To(Succeed())
+		})
+
+		It("should make zero write calls", func() {
+			counting := &writeCountingClient{Client: k8sClient}
+			controllerReconciler := &MyAppResourceReconciler{Client: counting, Scheme: k8sClient.Scheme()}
+
+			By("creating every child on the first reconcile")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(counting.writes).To(BeNumerically(">", 0))
+
+			By("writing nothing on the next reconcile")
+			skipped := testutil.ToFloat64(childApplyTotal.WithLabelValues("Deployment", applyResultSkipped))
+			counting.writes = 0
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(counting.writes).To(BeZero())
+			Expect(testutil.ToFloat64(childApplyTotal.WithLabelValues("Deployment", applyResultSkipped))).
+				To(Equal(skipped + 2))
+
+			By("applying only the child that drifted")
+			applied := testutil.ToFloat64(childApplyTotal.WithLabelValues("Deployment", applyResultApplied))
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			deployment.Spec.Template.Spec.Containers[0].Image = "busybox"
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutil.ToFloat64(childApplyTotal.WithLabelValues("Deployment", applyResultApplied))).
+				To(Equal(applied + 1))
+			Expect(testutil.ToFloat64(childApplyTotal.WithLabelValues("Deployment", applyResultSkipped))).
+				To(Equal(skipped + 3))
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:latest"))
+		})
+	})
+})
@@ -0,0 +1,151 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// eventDedupInterval is how long a warning is held back after an identical one was emitted for the same object, so a
+// reconcile failing over and over does not flood the namespace with events.
+const eventDedupInterval = 10 * time.Minute
+
+// Reasons of the events emitted for a myappresource.
+const (
+	eventReasonCreated        = "Created"
+	eventReasonUpdated        = "Updated"
+	eventReasonDeleted        = "Deleted"
+	eventReasonRedisEnabled   = "RedisEnabled"
+	eventReasonRedisDisabled  = "RedisDisabled"
+	eventReasonReady          = "Ready"
+	eventReasonNotReady       = "NotReady"
+	eventReasonReconcileError = "ReconcileError"
+	eventReasonConflict       = "Conflict"
+)
+
+// eventKey identifies warnings that are identical to one another.
+type eventKey struct {
+	uid             types.UID
+	reason, message string
+}
+
+// eventRecorder emits Kubernetes Events through a record.EventRecorder, dropping any warning identical to one emitted
+// for the same object within eventDedupInterval. Normal events each record a change that happened, such as a child
+// updated for a new spec, and are always emitted. A nil eventRecorder emits nothing.
+type eventRecorder struct {
+	recorder record.EventRecorder
+	now      func() time.Time
+
+	mu      sync.Mutex
+	emitted map[eventKey]time.Time
+}
+
+// newEventRecorder wraps recorder, or returns nil if there is none.
+func newEventRecorder(recorder record.EventRecorder) *eventRecorder {
+	if recorder == nil {
+		return nil
+	}
+	return &eventRecorder{recorder: recorder, now: time.Now, emitted: map[eventKey]time.Time{}}
+}
+
+// Eventf emits an event for obj, unless it is a warning identical to one emitted within eventDedupInterval.
+func (e *eventRecorder) Eventf(obj client.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	message := fmt.Sprintf(messageFmt, args...)
+	if eventType != corev1.EventTypeWarning {
+		e.recorder.Event(obj, eventType, reason, message)
+		return
+	}
+	key := eventKey{uid: obj.GetUID(), reason: reason, message: message}
+	now := e.now()
+
+	e.mu.Lock()
+	for k, at := range e.emitted {
+		if now.Sub(at) >= eventDedupInterval {
+			delete(e.emitted, k)
+		}
+	}
+	_, duplicate := e.emitted[key]
+	if !duplicate {
+		e.emitted[key] = now
+	}
+	e.mu.Unlock()
+
+	if !duplicate {
+		e.recorder.Event(obj, eventType, reason, message)
+	}
+}
+
+// forget drops what was emitted for the object of uid, once it is gone.
+func (e *eventRecorder) forget(uid types.UID) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for k := range e.emitted {
+		if k.uid == uid {
+			delete(e.emitted, k)
+		}
+	}
+}
+
+// recordStatusEvents records the outcome of a reconcile, and the transitions from the original status to the status
+// of myApp: Redis being enabled or disabled, and myApp becoming ready or not.
+func (r *MyAppResourceReconciler) recordStatusEvents(
+	original, myApp *podinfov1alpha1.MyAppResource, reconcileErr error,
+) {
+	switch {
+	case isConflict(reconcileErr):
+		r.events.Eventf(myApp, corev1.EventTypeWarning, eventReasonConflict, "%v", reconcileErr)
+	case reconcileErr != nil:
+		r.events.Eventf(myApp, corev1.EventTypeWarning, eventReasonReconcileError, "%v", reconcileErr)
+	}
+
+	// The RedisReady condition is only reported while Redis is enabled.
+	wasRedis := meta.FindStatusCondition(original.Status.Conditions, podinfov1alpha1.ConditionRedisReady) != nil
+	isRedis := meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady) != nil
+	switch {
+	case !wasRedis && isRedis:
+		r.events.Eventf(myApp, corev1.EventTypeNormal, eventReasonRedisEnabled, "Redis enabled")
+	case wasRedis && !isRedis:
+		r.events.Eventf(myApp, corev1.EventTypeNormal, eventReasonRedisDisabled, "Redis disabled")
+	}
+
+	// Only the transitions are recorded; a myApp that never was ready is reported by its conditions alone.
+	wasReady := meta.IsStatusConditionTrue(original.Status.Conditions, podinfov1alpha1.ConditionReady)
+	switch isReady := meta.IsStatusConditionTrue(myApp.Status.Conditions, podinfov1alpha1.ConditionReady); {
+	case !wasReady && isReady:
+		r.events.Eventf(myApp, corev1.EventTypeNormal, eventReasonReady, "MyAppResource is ready")
+	case wasReady && !isReady:
+		ready := meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionReady)
+		r.events.Eventf(myApp, corev1.EventTypeWarning, eventReasonNotReady, "MyAppResource is not ready: %s",
+			ready.Message)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// drainEvents returns the events recorded so far by recorder.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+var _ = Describe("MyAppResource Events", func() {
+	var (
+		fake   *record.FakeRecorder
+		events *eventRecorder
+		now    time.Time
+	)
+
+	BeforeEach(func() {
+		fake = record.NewFakeRecorder(100)
+		events = newEventRecorder(fake)
+		now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		events.now = func() time.Time { return now }
+	})
+
+	It("should drop warnings identical to one emitted within the dedup interval", func() {
+		myApp := &podinfov1alpha1.MyAppResource{ObjectMeta: metav1.ObjectMeta{Name: "test-resource", UID: "uid-1"}}
+		other := &podinfov1alpha1.MyAppResource{ObjectMeta: metav1.ObjectMeta{Name: "test-resource", UID: "uid-2"}}
+
+		events.Eventf(myApp, corev1.EventTypeWarning, eventReasonReconcileError, "boom")
+		events.Eventf(myApp, corev1.EventTypeWarning, eventReasonReconcileError, "boom")
+		events.Eventf(other, corev1.EventTypeWarning, eventReasonReconcileError, "boom")
+		events.Eventf(myApp, corev1.EventTypeWarning, eventReasonReconcileError, "bang")
+		Expect(drainEvents(fake)).To(Equal([]string{
+			"Warning ReconcileError boom",
+			"Warning ReconcileError boom",
+			"Warning ReconcileError bang",
+		}))
+
+		By("emitting it again once the interval passed")
+		now = now.Add(eventDedupInterval)
+		events.Eventf(myApp, corev1.EventTypeWarning, eventReasonReconcileError, "boom")
+		Expect(drainEvents(fake)).To(Equal([]string{"Warning ReconcileError boom"}))
+
+		By("emitting it again once the object was forgotten")
+		events.forget(myApp.UID)
+		events.Eventf(myApp, corev1.EventTypeWarning, eventReasonReconcileError, "boom")
+		Expect(drainEvents(fake)).To(Equal([]string{"Warning ReconcileError boom"}))
+
+		By("emitting every normal event, identical or not")
+		events.Eventf(myApp, corev1.EventTypeNormal, eventReasonUpdated, "Updated Deployment test-resource")
+		events.Eventf(myApp, corev1.EventTypeNormal, eventReasonUpdated, "Updated Deployment test-resource")
+		Expect(drainEvents(fake)).To(Equal([]string{
+			"Normal Updated Updated Deployment test-resource",
+			"Normal Updated Updated Deployment test-resource",
+		}))
+	})
+
+	It("should record readiness and redis transitions, and reconcile errors", func() {
+		r := &MyAppResourceReconciler{events: events}
+		myApp := &podinfov1alpha1.MyAppResource{ObjectMeta: metav1.ObjectMeta{Name: "test-resource", UID: "uid-1"}}
+		myApp.Spec.Redis.Enabled = true
+
+		original := myApp.DeepCopy()
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2),
+			rolledOutDeployment("test-resource-redis", 1), nil, nil)
+		r.recordStatusEvents(original, myApp, nil)
+		Expect(drainEvents(fake)).To(Equal([]string{
+			"Normal RedisEnabled Redis enabled",
+			"Normal Ready MyAppResource is ready",
+		}))
+
+		By("recording nothing while nothing changes")
+		original = myApp.DeepCopy()
+		r.recordStatusEvents(original, myApp, nil)
+		Expect(drainEvents(fake)).To(BeEmpty())
+
+		By("recording a failing reconcile once")
+		for i := 0; i < 3; i++ {
+			original = myApp.DeepCopy()
+			setStatusConditions(myApp, rolledOutDeployment("test-resource", 2),
+				rolledOutDeployment("test-resource-redis", 1), nil, errors.New("boom"))
+			r.recordStatusEvents(original, myApp, errors.New("boom"))
+		}
+		Expect(drainEvents(fake)).To(Equal([]string{
+			"Warning ReconcileError boom",
+			"Warning NotReady MyAppResource is not ready: boom",
+		}))
+
+		By("recording redis being disabled, and readiness again")
+		original = myApp.DeepCopy()
+		myApp.Spec.Redis.Enabled = false
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil, nil, nil)
+		r.recordStatusEvents(original, myApp, nil)
+		Expect(drainEvents(fake)).To(Equal([]string{
+			"Normal RedisDisabled Redis disabled",
+			"Normal Ready MyAppResource is ready",
+		}))
+	})
+
+	Context("When reconciling", func() {
+		const (
+			resourceName = "evented-resource"
+			namespace    = "events"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Redis: podinfov1alpha1.Redis{Enabled: true},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should record the children it creates, updates and deletes", func() {
+			controllerReconciler := &MyAppResourceReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+				events: events,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(drainEvents(fake)).To(ContainElements(
+				"Normal Created Created Deployment "+resourceName,
+				"Normal Created Created Service "+resourceName,
+				"Normal Created Created Deployment "+resourceName+redisNamePostfix,
+				"Normal RedisEnabled Redis enabled",
+			))
+
+			By("recording the children changed by a spec change")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.UI.Message = "updated"
+			myappresource.Spec.Redis.Enabled = false
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(drainEvents(fake)).To(ContainElements(
+				"Normal Updated Updated Deployment "+resourceName,
+				"Normal Deleted Deleted Deployment "+resourceName+redisNamePostfix,
+				"Normal Deleted Deleted Service "+resourceName+redisNamePostfix,
+				"Normal RedisDisabled Redis disabled",
+			))
+
+			By("recording another update for a second spec change")
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.UI.Message = "updated again"
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(drainEvents(fake)).To(ContainElement("Normal Updated Updated Deployment " + resourceName))
+		})
+	})
+})
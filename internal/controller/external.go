@@ -0,0 +1,62 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+	"time"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// externalRedisResolveTimeout bounds the lookup of an external Redis address, so an unreachable DNS server does not
+// stall the reconcile.
+const externalRedisResolveTimeout = 5 * time.Second
+
+// externalRedisRequeueInterval is how soon an external Redis address that did not resolve is looked up again.
+const externalRedisRequeueInterval = time.Minute
+
+// HostResolver looks up the addresses of a host, as *net.Resolver does.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// redisExternal returns the external Redis of myApp, or nil when Redis is disabled or run by the operator.
+func redisExternal(myApp *podinfov1alpha1.MyAppResource) *podinfov1alpha1.RedisExternal {
+	if !myApp.Spec.Redis.Enabled {
+		return nil
+	}
+	return myApp.Spec.Redis.External
+}
+
+// resolveRedisExternal looks up the address of the external Redis. An IP address always resolves.
+func (r *MyAppResourceReconciler) resolveRedisExternal(
+	ctx context.Context, external *podinfov1alpha1.RedisExternal,
+) error {
+	if net.ParseIP(external.Address) != nil {
+		return nil
+	}
+	var resolver HostResolver = net.DefaultResolver
+	if r.Resolver != nil {
+		resolver = r.Resolver
+	}
+	ctx, cancel := context.WithTimeout(ctx, externalRedisResolveTimeout)
+	defer cancel()
+	_, err := resolver.LookupHost(ctx, external.Address)
+	return err
+}
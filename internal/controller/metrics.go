@@ -0,0 +1,231 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// Results of an apply attempt, as counted by childApplyTotal.
+const (
+	applyResultApplied = "applied"
+	applyResultSkipped = "skipped"
+)
+
+// Verbs of a child write, as counted by childWritesTotal.
+const (
+	writeVerbCreate = "create"
+	writeVerbUpdate = "update"
+	writeVerbDelete = "delete"
+)
+
+// Reasons of a reconcile error that is not a Kubernetes API error, as counted by reconcileErrorsTotal.
+const (
+	errorReasonNotOwned = "NotOwned"
+	errorReasonUnknown  = "Unknown"
+)
+
+// appLabels are the labels of every per-myappresource metric.
+var appLabels = []string{"name", "namespace"}
+
+var (
+	// childApplyTotal counts, per child resource kind, the applies issued and the applies skipped because the
+	// observed object already matched the desired state.
+	childApplyTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podinfo_operator_child_apply_total",
+			Help: "Number of child resource applies by kind and result (applied or skipped).",
+		},
+		[]string{"kind", "result"},
+	)
+
+	appReady = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podinfo_operator_myappresource_ready",
+			Help: "Whether the myappresource is ready (1) or not (0).",
+		},
+		appLabels,
+	)
+	appDesiredReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podinfo_operator_myappresource_desired_replicas",
+			Help: "Number of podinfo replicas the myappresource's deployment asks for.",
+		},
+		appLabels,
+	)
+	appReadyReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podinfo_operator_myappresource_ready_replicas",
+			Help: "Number of ready podinfo replicas of the myappresource's deployment.",
+		},
+		appLabels,
+	)
+	appRedisEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podinfo_operator_myappresource_redis_enabled",
+			Help: "Whether Redis is enabled (1) or not (0) for the myappresource.",
+		},
+		appLabels,
+	)
+	// appTimeToReady observes, per spec generation, the time from the operator first reconciling it (or the
+	// myappresource being created, for the first) to the myappresource reporting ready for it. The API server does not
+	// record when a spec changed, so a change waiting in the queue is not counted.
+	appTimeToReady = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "podinfo_operator_myappresource_time_to_ready_seconds",
+			Help:    "Time from the first reconcile of a myappresource generation to it being ready, in seconds.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		appLabels,
+	)
+	childWritesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podinfo_operator_child_writes_total",
+			Help: "Number of writes to the children of a myappresource by kind and verb (create, update or delete).",
+		},
+		append(appLabels, "kind", "verb"),
+	)
+	reconcileErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podinfo_operator_reconcile_errors_total",
+			Help: "Number of failed reconciles of a myappresource by reason.",
+		},
+		append(appLabels, "reason"),
+	)
+
+	// appMetrics are the metrics labelled per myappresource, dropped by deleteAppMetrics.
+	appMetrics = []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{appReady, appDesiredReplicas, appReadyReplicas, appRedisEnabled, appTimeToReady, childWritesTotal,
+		reconcileErrorsTotal}
+)
+
+func init() {
+	metrics.Registry.MustRegister(childApplyTotal, appReady, appDesiredReplicas, appReadyReplicas, appRedisEnabled,
+		appTimeToReady, childWritesTotal, reconcileErrorsTotal)
+}
+
+// pendingReady tracks, per myappresource, the spec generation not yet ready and since when it was waited on. It is
+// kept in memory, so a generation pending while the operator restarts is not observed by appTimeToReady.
+var pendingReady = struct {
+	sync.Mutex
+	generations map[types.NamespacedName]pendingGeneration
+}{generations: map[types.NamespacedName]pendingGeneration{}}
+
+// pendingGeneration is a spec generation of a myappresource waiting to be ready.
+type pendingGeneration struct {
+	generation int64
+	since      time.Time
+}
+
+// boolToFloat returns 1 for true and 0 for false, as gauges report booleans.
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// recordStatusMetrics reports the status of myApp, as rolled up from dep, in the per-myappresource gauges, and
+// observes the time a spec change took to be ready. original is myApp as last reconciled.
+func recordStatusMetrics(original, myApp *podinfov1alpha1.MyAppResource, dep *appsv1.Deployment) {
+	name, namespace := myApp.Name, myApp.Namespace
+	appReady.WithLabelValues(name, namespace).Set(boolToFloat(myApp.Status.Ready))
+	appRedisEnabled.WithLabelValues(name, namespace).Set(boolToFloat(myApp.Spec.Redis.Enabled))
+	desired, ready := int32(0), int32(0)
+	if myApp.Spec.ReplicaCount != nil {
+		desired = *myApp.Spec.ReplicaCount
+	}
+	// An autoscaled deployment's replicas are the autoscaler's.
+	if dep != nil {
+		if dep.Spec.Replicas != nil {
+			desired = *dep.Spec.Replicas
+		}
+		ready = dep.Status.ReadyReplicas
+	}
+	appDesiredReplicas.WithLabelValues(name, namespace).Set(float64(desired))
+	appReadyReplicas.WithLabelValues(name, namespace).Set(float64(ready))
+
+	key := client.ObjectKeyFromObject(myApp)
+	now := time.Now()
+	pendingReady.Lock()
+	defer pendingReady.Unlock()
+	pending, ok := pendingReady.generations[key]
+	if original.Status.ObservedGeneration != myApp.Generation && (!ok || pending.generation != myApp.Generation) {
+		// The first generation was waited on since the myappresource was created.
+		since := now
+		if myApp.Generation == 1 {
+			since = myApp.CreationTimestamp.Time
+		}
+		pending, ok = pendingGeneration{generation: myApp.Generation, since: since}, true
+		pendingReady.generations[key] = pending
+	}
+	if ok && myApp.Status.Ready && pending.generation == myApp.Generation {
+		appTimeToReady.WithLabelValues(name, namespace).Observe(now.Sub(pending.since).Seconds())
+		delete(pendingReady.generations, key)
+	}
+}
+
+// recordReconcileError counts a failed reconcile of the myappresource of key by the reason of err: the Kubernetes API
+// reason, or errorReasonNotOwned for a conflictError.
+func recordReconcileError(key types.NamespacedName, err error) {
+	reason := errorReasonUnknown
+	if isConflict(err) {
+		reason = errorReasonNotOwned
+	} else if apiReason := k8serrs.ReasonForError(err); apiReason != "" {
+		reason = string(apiReason)
+	}
+	reconcileErrorsTotal.WithLabelValues(key.Name, key.Namespace, reason).Inc()
+}
+
+// recordChildWrite records a write of verb to the named child of myApp of kind, both as an event of myApp and in
+// childWritesTotal.
+func (r *MyAppResourceReconciler) recordChildWrite(
+	myApp *podinfov1alpha1.MyAppResource, verb, kind, name string,
+) {
+	childWritesTotal.WithLabelValues(myApp.Name, myApp.Namespace, kind, verb).Inc()
+	switch verb {
+	case writeVerbCreate:
+		r.events.Eventf(myApp, corev1.EventTypeNormal, eventReasonCreated, "Created %s %s", kind, name)
+	case writeVerbUpdate:
+		r.events.Eventf(myApp, corev1.EventTypeNormal, eventReasonUpdated, "Updated %s %s", kind, name)
+	case writeVerbDelete:
+		r.events.Eventf(myApp, corev1.EventTypeNormal, eventReasonDeleted, "Deleted %s %s", kind, name)
+	}
+}
+
+// deleteAppMetrics drops every metric labelled for the myappresource of key, once it is gone.
+func deleteAppMetrics(key types.NamespacedName) {
+	labels := prometheus.Labels{"name": key.Name, "namespace": key.Namespace}
+	for _, metric := range appMetrics {
+		metric.DeletePartialMatch(labels)
+	}
+	pendingReady.Lock()
+	delete(pendingReady.generations, key)
+	pendingReady.Unlock()
+}
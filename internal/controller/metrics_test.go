@@ -0,0 +1,202 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	k8serrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// timeToReadyCount returns the number of times a spec change of the named myappresource was observed ready.
+func timeToReadyCount(name, namespace string) uint64 {
+	metric := &dto.Metric{}
+	Expect(appTimeToReady.WithLabelValues(name, namespace).(prometheus.Histogram).Write(metric)).To(Succeed())
+	return metric.GetHistogram().GetSampleCount()
+}
+
+// appSeries returns the number of series registered for the named myappresource.
+func appSeries(name, namespace string) int {
+	families, err := metrics.Registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	series := 0
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["name"] == name && labels["namespace"] == namespace {
+				series++
+			}
+		}
+	}
+	return series
+}
+
+// failingPatchClient fails every patch with err.
+type failingPatchClient struct {
+	client.Client
+	err error
+}
+
+func (c failingPatchClient) Patch(context.Context, client.Object, client.Patch, ...client.PatchOption) error {
+	return c.err
+}
+
+var _ = Describe("MyAppResource Metrics", func() {
+	It("should report the status of a myappresource and the time each spec change took to be ready", func() {
+		myApp := &podinfov1alpha1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "timed-resource",
+				Namespace:         "metrics-unit",
+				Generation:        1,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Minute)),
+			},
+			Spec: podinfov1alpha1.MyAppResourceSpec{
+				ReplicaCount: ptr(int32(3)),
+				Redis:        podinfov1alpha1.Redis{Enabled: true},
+			},
+		}
+		DeferCleanup(deleteAppMetrics, client.ObjectKeyFromObject(myApp))
+
+		By("waiting on the first generation while the deployment rolls out")
+		original := myApp.DeepCopy()
+		myApp.Status.ObservedGeneration = 1
+		recordStatusMetrics(original, myApp, nil)
+		Expect(testutil.ToFloat64(appReady.WithLabelValues("timed-resource", "metrics-unit"))).To(BeZero())
+		Expect(testutil.ToFloat64(appRedisEnabled.WithLabelValues("timed-resource", "metrics-unit"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(appDesiredReplicas.WithLabelValues("timed-resource", "metrics-unit"))).To(Equal(3.0))
+		Expect(testutil.ToFloat64(appReadyReplicas.WithLabelValues("timed-resource", "metrics-unit"))).To(BeZero())
+		Expect(timeToReadyCount("timed-resource", "metrics-unit")).To(BeZero())
+
+		By("observing the time since creation once ready")
+		original = myApp.DeepCopy()
+		myApp.Status.Ready = true
+		recordStatusMetrics(original, myApp, rolledOutDeployment("timed-resource", 3))
+		Expect(testutil.ToFloat64(appReady.WithLabelValues("timed-resource", "metrics-unit"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(appReadyReplicas.WithLabelValues("timed-resource", "metrics-unit"))).To(Equal(3.0))
+		Expect(timeToReadyCount("timed-resource", "metrics-unit")).To(Equal(uint64(1)))
+
+		By("observing nothing more until the spec changes")
+		original = myApp.DeepCopy()
+		recordStatusMetrics(original, myApp, rolledOutDeployment("timed-resource", 3))
+		Expect(timeToReadyCount("timed-resource", "metrics-unit")).To(Equal(uint64(1)))
+		original = myApp.DeepCopy()
+		myApp.Generation = 2
+		myApp.Status.ObservedGeneration = 2
+		recordStatusMetrics(original, myApp, rolledOutDeployment("timed-resource", 3))
+		Expect(timeToReadyCount("timed-resource", "metrics-unit")).To(Equal(uint64(2)))
+	})
+
+	It("should count reconcile errors by reason", func() {
+		key := types.NamespacedName{Name: "failing", Namespace: "metrics-unit"}
+		DeferCleanup(deleteAppMetrics, key)
+
+		recordReconcileError(key, &conflictError{"Service", "failing", "it is controlled by Helm failing"})
+		recordReconcileError(key, k8serrs.NewConflict(schema.GroupResource{Resource: "deployments"}, "failing", nil))
+		recordReconcileError(key, errors.New("boom"))
+		Expect(testutil.ToFloat64(reconcileErrorsTotal.WithLabelValues("failing", "metrics-unit", errorReasonNotOwned))).
+			To(Equal(1.0))
+		Expect(testutil.ToFloat64(reconcileErrorsTotal.WithLabelValues("failing", "metrics-unit",
+			string(metav1.StatusReasonConflict)))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(reconcileErrorsTotal.WithLabelValues("failing", "metrics-unit", errorReasonUnknown))).
+			To(Equal(1.0))
+	})
+
+	Context("When a myappresource is reconciled and deleted", func() {
+		const (
+			resourceName = "measured-resource"
+			namespace    = "metrics"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(2)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+				},
+			})).To(Succeed())
+		})
+
+		It("should count the child writes, and drop every metric of the myappresource once it is gone", func() {
+			performReconcilation(ctx, namespacedName)
+			Expect(testutil.ToFloat64(childWritesTotal.WithLabelValues(resourceName, namespace, "Deployment",
+				writeVerbCreate))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(childWritesTotal.WithLabelValues(resourceName, namespace, "Service",
+				writeVerbCreate))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(appDesiredReplicas.WithLabelValues(resourceName, namespace))).To(Equal(2.0))
+			Expect(testutil.ToFloat64(appRedisEnabled.WithLabelValues(resourceName, namespace))).To(BeZero())
+
+			Expect(appSeries(resourceName, namespace)).NotTo(BeZero())
+			tearDown(ctx, namespacedName)
+			Expect(appSeries(resourceName, namespace)).To(BeZero())
+		})
+
+		It("should count the errors of adding the finalizer and of tearing down", func() {
+			conflictErrors := func() float64 {
+				return testutil.ToFloat64(reconcileErrorsTotal.WithLabelValues(resourceName, namespace,
+					string(metav1.StatusReasonConflict)))
+			}
+			stale := k8serrs.NewConflict(schema.GroupResource{Resource: "myappresources"}, resourceName, nil)
+			controllerReconciler := &MyAppResourceReconciler{
+				Client: failingPatchClient{Client: k8sClient, err: stale},
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).To(HaveOccurred())
+			Expect(conflictErrors()).To(Equal(1.0))
+
+			By("counting a failing teardown step")
+			performReconcilation(ctx, namespacedName)
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, myappresource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).To(HaveOccurred())
+			Expect(conflictErrors()).To(Equal(2.0))
+
+			tearDown(ctx, namespacedName)
+		})
+	})
+})
@@ -18,17 +18,27 @@ package controller
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/hashicorp/go-multierror"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	k8serrs "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
 )
@@ -37,6 +47,21 @@ import (
 type MyAppResourceReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Resolver looks up the address of an external Redis. Defaults to net.DefaultResolver.
+	Resolver HostResolver
+
+	// Recorder emits the Kubernetes Events of every myappresource. No events are emitted without one.
+	Recorder record.EventRecorder
+
+	// TracerProvider provides the tracer of the reconcile spans. Defaults to the global otel.TracerProvider.
+	TracerProvider trace.TracerProvider
+
+	// events deduplicates the events emitted through Recorder; set up by SetupWithManager.
+	events *eventRecorder
+
+	// installedKinds are the optionalKinds found in the cluster by SetupWithManager.
+	installedKinds map[schema.GroupVersionKind]bool
 }
 
 // MyAppResources.
@@ -47,28 +72,84 @@ type MyAppResourceReconciler struct {
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get
 
+// K8s StatefulSets.
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get
+
 // Services.
 //+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=services/status,verbs=get
 
+// Secrets holding the Redis password.
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;delete
+
+// HorizontalPodAutoscalers.
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+
+// Pods and their ReplicaSets, counted while tearing a deleted myappresource down.
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+
+// PersistentVolumeClaims of a persistent Redis, deleted along with a deleted myappresource with deleteClaims.
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;delete
+
+// PodDisruptionBudgets.
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+
+// NetworkPolicies.
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+// Ingresses.
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+
+// Gateway API routes.
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;grpcroutes,verbs=get;list;watch;create;update;patch;delete
+
+// Events of the myappresources.
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Prometheus operator monitors and rules.
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;podmonitors;prometheusrules,verbs=get;list;watch;create;update;patch;delete
+
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *MyAppResourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, retErr error) {
 	log := log.FromContext(ctx)
+	ctx, span := r.tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		attrMyAppName.String(req.Name), attrMyAppNamespace.String(req.Namespace)))
+	defer func() {
+		// Every failed reconcile is counted here, whichever step failed. An object the myApp does not own is not
+		// watched, so a conflict is checked again later rather than retried with backoff.
+		if retErr != nil {
+			recordReconcileError(req.NamespacedName, retErr)
+		}
+		if isConflict(retErr) {
+			res, retErr = ctrl.Result{RequeueAfter: conflictRequeueInterval}, nil
+		}
+		span.SetAttributes(attrRequeue.Bool(res.Requeue), attrRequeueAfter.String(res.RequeueAfter.String()))
+		endSpan(span, retErr)
+	}()
+
 	// Fetch input myApp custom resource.
 	myApp := &podinfov1alpha1.MyAppResource{}
 	if err := r.Get(ctx, req.NamespacedName, myApp); err != nil {
 		// Ignore not-found errors, since it can't be fixed by an immediate requeue (need to wait for a new notification).
+		// A myApp deleted without its finalizer leaves its metrics behind otherwise.
+		if k8serrs.IsNotFound(err) {
+			deleteAppMetrics(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 	log.V(1).Info("myappresource found", "name", myApp.Name)
+	span.SetAttributes(attrMyAppGeneration.Int64(myApp.Generation))
 
-	// If deletion timestamp. Do nothing.
-	// If cluster external resources were created, one would need to use a finalizer and perform cleanup in a
-	// reconcilDelete function of sorts.
-	// Since everything created here is a k8s construct, just let the owner-refs perform cleanup.
+	// Owner-refs would garbage collect every child at once; the finalizer holds the deletion until reconcileDelete
+	// tore them down in order.
 	if myApp.GetDeletionTimestamp() != nil {
-		return ctrl.Result{}, nil
+		return r.reconcileDelete(ctx, myApp)
+	}
+	if err := r.ensureFinalizer(ctx, myApp); err != nil {
+		return ctrl.Result{}, err
 	}
 	// otherwise reconcile.
 	return r.reconcile(ctx, req, myApp)
@@ -78,175 +159,443 @@ func (r *MyAppResourceReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 func (r *MyAppResourceReconciler) reconcile(
 	ctx context.Context, req ctrl.Request, myApp *podinfov1alpha1.MyAppResource,
 ) (ctrl.Result, error) {
-	// Create or Updtate deployment and services as needed.
-	if err := r.createOrUpdateDeployment(ctx, req, myApp); err != nil {
-		return ctrl.Result{}, err
-	} else if err = r.createOrUpdateService(ctx, req, myApp); err != nil {
-		return ctrl.Result{}, err
-	} else if err = r.reconcileRedis(ctx, myApp); err != nil {
-		return ctrl.Result{}, err
+	// Create or Updtate deployment and services as needed, then report the outcome in the status either way.
+	err := r.reconcileResources(ctx, req, myApp)
+	if statusErr := r.updateStatus(ctx, myApp, err); statusErr != nil {
+		err = multierror.Append(err, statusErr)
 	}
 
-	// Requeue until the status goes ready.
-	// TODO (reedjosh) Should do this with watches instead!
-	return ctrl.Result{Requeue: !myApp.Status.Ready}, nil
+	// No need to requeue until ready; the owned Deployments and Services are watched, so any change to their status
+	// (or their removal) triggers another reconcile. Nothing is watched for an external Redis, so an address that did
+	// not resolve is retried.
+	if redisExternal(myApp) != nil &&
+		!meta.IsStatusConditionTrue(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady) {
+		return ctrl.Result{RequeueAfter: externalRedisRequeueInterval}, err
+	}
+	return ctrl.Result{}, err
 }
 
-// createOrUpdateDeployment attempts to create or update desired myApp deployment.
-// TODO (reedjosh) would use ctrl.CreateOrUpdate but cuases test failures.
-func (r *MyAppResourceReconciler) createOrUpdateDeployment(
-	ctx context.Context, _ ctrl.Request, myApp *podinfov1alpha1.MyAppResource,
+// reconcileResources creates, updates or deletes every child resource of myApp.
+func (r *MyAppResourceReconciler) reconcileResources(
+	ctx context.Context, req ctrl.Request, myApp *podinfov1alpha1.MyAppResource,
 ) error {
-	log := log.FromContext(ctx)
-
-	// Fetch existing deployment...
-	foundDeployment := &appsv1.Deployment{}
-	err := r.Get(ctx, types.NamespacedName{Name: myApp.Name, Namespace: myApp.Namespace}, foundDeployment)
-
-	// Return if err and not just because the deployment wasn't found.
-	if err != nil && !k8serrs.IsNotFound(err) {
+	// The Redis password must exist before any pod referencing it is rolled out.
+	authHash, err := r.reconcileRedisAuth(ctx, myApp)
+	if err != nil {
 		return err
 	}
-
-	// Deployment not found, create it.
-	if err != nil {
-		log.V(1).Info("Creating Deployment", "deployment", myApp.Name)
-		return r.Create(ctx, buildDeployment(myApp))
+	// A child held up by an object the myApp does not own does not hold up the others; the conflicts are reported
+	// together once every step ran.
+	var conflicts error
+	for _, step := range []func() error{
+		func() error { return r.createOrUpdateDeployment(ctx, req, myApp, authHash) },
+		func() error { return r.createOrUpdateService(ctx, req, myApp) },
+		func() error { return r.reconcileAutoscaling(ctx, myApp) },
+		func() error { return r.reconcileDisruptionBudget(ctx, myApp) },
+		func() error { return r.reconcileNetworkPolicies(ctx, myApp) },
+		func() error { return r.reconcileIngress(ctx, myApp) },
+		func() error { return r.reconcileGateway(ctx, myApp) },
+		func() error { return r.reconcileMonitoring(ctx, myApp) },
+		func() error { return r.reconcileAlerting(ctx, myApp) },
+		func() error { return r.reconcileRedis(ctx, myApp, authHash) },
+	} {
+		if err := step(); isConflict(err) {
+			conflicts = multierror.Append(conflicts, err)
+		} else if err != nil {
+			return err
+		}
 	}
+	return conflicts
+}
 
-	// Deployment found, propagate status.
-	// TODO (reedjosh) build a better status rollup of all resources along with a better watch on said resources.
-	// TODO (reedjosh) patch the status diff instead of the whole object.
-	myApp.Status.Ready = foundDeployment.Status.ReadyReplicas == *myApp.Spec.ReplicaCount
-	if err = r.Status().Update(ctx, myApp); err != nil {
-		return fmt.Errorf("error patching myappresource: %w", err)
+// createOrUpdateDeployment server-side applies the desired myApp deployment.
+//
+// While autoscaling, the replica count is the HorizontalPodAutoscaler's. Until the autoscaler has written it though,
+// the operator is its only manager, and dropping it from the apply would reset it to 1; the current count is applied
+// instead until then.
+func (r *MyAppResourceReconciler) createOrUpdateDeployment(
+	ctx context.Context, _ ctrl.Request, myApp *podinfov1alpha1.MyAppResource, authHash string,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "createOrUpdateDeployment", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	log.V(1).Info("Applying Deployment", "deployment", myApp.Name)
+	dep := buildDeployment(myApp)
+	setRedisAuthHash(&dep.Spec.Template, authHash)
+	if myApp.Spec.Autoscaling.Enabled {
+		observed, err := r.getDeployment(ctx, myApp.Name, myApp.Namespace)
+		if err != nil {
+			return err
+		}
+		if observed != nil && !managedByOthers(observed, "f:spec", "f:replicas") {
+			dep.Spec.Replicas = observed.Spec.Replicas
+		}
 	}
-
-	// Deployment found, update it.
-	// TODO (reedjosh) do a nice comparison. Skip update if no diff. Potentially patch instead of update.
-	log.V(1).Info("Updating Deployment", "deployment", myApp.Name)
-	err = r.Update(ctx, buildDeployment(myApp))
-	return err
+	return r.apply(ctx, myApp, dep)
 }
 
-// createOrUpdateService attempts to create or update desired myApp service.
-// TODO (reedjosh) would use ctrl.CreateOrUpdate but cuases test failures.
+// createOrUpdateService server-side applies the desired myApp service.
 func (r *MyAppResourceReconciler) createOrUpdateService(
 	ctx context.Context, _ ctrl.Request, myApp *podinfov1alpha1.MyAppResource,
-) error {
+) (err error) {
+	ctx, span := r.startSpan(ctx, "createOrUpdateService", myApp)
+	defer func() { endSpan(span, err) }()
 	log := log.FromContext(ctx)
-	// Fetch existing service...
-	foundService := &corev1.Service{}
-	err := r.Get(ctx, types.NamespacedName{Name: myApp.Name, Namespace: myApp.Namespace}, foundService)
+	log.V(1).Info("Applying Service", "service", myApp.Name)
+	return r.apply(ctx, myApp, buildService(myApp))
+}
 
-	// Return if err and not just because the service wasn't found.
-	if err != nil && !k8serrs.IsNotFound(err) {
-		return err
+// reconcileAutoscaling applies the podinfo HorizontalPodAutoscaler while autoscaling is enabled, and deletes it
+// otherwise.
+func (r *MyAppResourceReconciler) reconcileAutoscaling(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileAutoscaling", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	if myApp.Spec.Autoscaling.Enabled {
+		log.V(1).Info("Applying HorizontalPodAutoscaler", "horizontalpodautoscaler", myApp.Name)
+		return r.apply(ctx, myApp, buildHorizontalPodAutoscaler(myApp))
 	}
+	return r.deleteIfExists(ctx, myApp, &autoscalingv2.HorizontalPodAutoscaler{}, myApp.Name)
+}
 
-	// Service not found, create it.
-	desiredSvc := buildService(myApp)
-	if err != nil {
-		log.V(1).Info("Creating Service", "service", myApp.Name)
-		return r.Create(ctx, desiredSvc)
+// reconcileDisruptionBudget applies the podinfo PodDisruptionBudget while podinfo runs more than one replica, and
+// deletes it otherwise. While autoscaling, the minimum replica count is what podinfo may be scaled down to, so it
+// decides; a budget over a single pod could otherwise block node drains.
+func (r *MyAppResourceReconciler) reconcileDisruptionBudget(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileDisruptionBudget", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	replicas := myApp.Spec.ReplicaCount
+	if myApp.Spec.Autoscaling.Enabled {
+		replicas = myApp.Spec.Autoscaling.MinReplicas
+	}
+	if replicas != nil && *replicas > 1 {
+		log.V(1).Info("Applying PodDisruptionBudget", "poddisruptionbudget", myApp.Name)
+		return r.apply(ctx, myApp, buildPodDisruptionBudget(myApp))
 	}
+	return r.deleteIfExists(ctx, myApp, &policyv1.PodDisruptionBudget{}, myApp.Name)
+}
 
-	// Service found, update it.
-	// TODO (reedjosh) do a nice comparison and even potentially patch instead of update.
-	log.V(1).Info("Updating Service", "service", desiredSvc.Name)
-	err = r.Update(ctx, desiredSvc)
-	return err
+// reconcileNetworkPolicies applies the podinfo NetworkPolicy, and that of the operator's Redis while it runs one,
+// while network policies are enabled, and deletes them otherwise.
+func (r *MyAppResourceReconciler) reconcileNetworkPolicies(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileNetworkPolicies", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	enabled := myApp.Spec.NetworkPolicy.Enabled == nil || *myApp.Spec.NetworkPolicy.Enabled
+	if enabled {
+		log.V(1).Info("Applying NetworkPolicy", "networkpolicy", myApp.Name)
+		if err := r.apply(ctx, myApp, buildNetworkPolicy(myApp)); err != nil {
+			return err
+		}
+	} else if err := r.deleteIfExists(ctx, myApp, &networkingv1.NetworkPolicy{}, myApp.Name); err != nil {
+		return err
+	}
+	redisName := myApp.Name + redisNamePostfix
+	if enabled && myApp.Spec.Redis.Enabled && redisExternal(myApp) == nil {
+		log.V(1).Info("Applying NetworkPolicy", "networkpolicy", redisName)
+		return r.apply(ctx, myApp, buildRedisNetworkPolicy(myApp))
+	}
+	return r.deleteIfExists(ctx, myApp, &networkingv1.NetworkPolicy{}, redisName)
 }
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *MyAppResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&podinfov1alpha1.MyAppResource{}).
-		Complete(r)
+// reconcileIngress applies the podinfo Ingress while spec.ingress is set, and deletes it otherwise.
+func (r *MyAppResourceReconciler) reconcileIngress(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileIngress", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	if myApp.Spec.Ingress != nil {
+		log.V(1).Info("Applying Ingress", "ingress", myApp.Name)
+		return r.apply(ctx, myApp, buildIngress(myApp))
+	}
+	return r.deleteIfExists(ctx, myApp, &networkingv1.Ingress{}, myApp.Name)
 }
 
-// reconcileRedis calls create update or delete for the redis application.
-func (r *MyAppResourceReconciler) reconcileRedis(ctx context.Context, myApp *podinfov1alpha1.MyAppResource) error {
-	if myApp.Spec.Redis.Enabled {
-		if err := r.createOrUpdateRedisDeployment(ctx, myApp); err != nil {
+// reconcileGateway applies the podinfo HTTPRoute, and GRPCRoute when enabled, while spec.gateway is set, and deletes
+// them otherwise. Routes of a kind not installed in the cluster are skipped; the RoutesAccepted condition reports them.
+func (r *MyAppResourceReconciler) reconcileGateway(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileGateway", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	gateway := myApp.Spec.Gateway
+	if r.kindInstalled(&gatewayv1.HTTPRoute{}) {
+		if gateway != nil {
+			log.V(1).Info("Applying HTTPRoute", "httproute", myApp.Name)
+			if err := r.apply(ctx, myApp, buildHTTPRoute(myApp)); err != nil {
+				return err
+			}
+		} else if err := r.deleteIfExists(ctx, myApp, &gatewayv1.HTTPRoute{}, myApp.Name); err != nil {
 			return err
 		}
-		return r.createOrUpdateRedisService(ctx, myApp)
 	}
-	return r.reconcileDeleteRedis(ctx, myApp)
+	if r.kindInstalled(&gatewayv1alpha2.GRPCRoute{}) {
+		if gateway != nil && gateway.GRPC {
+			log.V(1).Info("Applying GRPCRoute", "grpcroute", myApp.Name)
+			return r.apply(ctx, myApp, buildGRPCRoute(myApp))
+		}
+		return r.deleteIfExists(ctx, myApp, &gatewayv1alpha2.GRPCRoute{}, myApp.Name)
+	}
+	return nil
 }
 
-func (r *MyAppResourceReconciler) createOrUpdateRedisService(
+// reconcileMonitoring applies the podinfo monitor of the configured kind while monitoring is enabled, and deletes
+// the monitors of other kinds. Monitors of a kind not installed in the cluster are skipped.
+func (r *MyAppResourceReconciler) reconcileMonitoring(
 	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
-) error {
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileMonitoring", myApp)
+	defer func() { endSpan(span, err) }()
 	log := log.FromContext(ctx)
-	// Fetch existing service...
-	foundService := &corev1.Service{}
-	err := r.Get(ctx, types.NamespacedName{Name: myApp.Name + "-redis", Namespace: myApp.Namespace}, foundService)
+	monitoring := myApp.Spec.Monitoring
+	kind := monitoring.Kind
+	if kind == "" {
+		kind = podinfov1alpha1.MonitoringServiceMonitor
+	}
+	monitors := []struct {
+		kind    podinfov1alpha1.MonitoringKind
+		desired client.Object
+	}{
+		{podinfov1alpha1.MonitoringServiceMonitor, buildServiceMonitor(myApp)},
+		{podinfov1alpha1.MonitoringPodMonitor, buildPodMonitor(myApp)},
+	}
+	for _, monitor := range monitors {
+		wanted := monitoring.Enabled && monitor.kind == kind
+		switch {
+		case !r.kindInstalled(monitor.desired):
+			if wanted {
+				log.V(1).Info("Skipping "+string(monitor.kind)+", its CRD is not installed", "name", myApp.Name)
+			}
+		case wanted:
+			log.V(1).Info("Applying "+string(monitor.kind), "name", myApp.Name)
+			if err := r.apply(ctx, myApp, monitor.desired); err != nil {
+				return err
+			}
+		default:
+			if err := r.deleteIfExists(ctx, myApp, monitor.desired, myApp.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-	// Return if err and not just because the service wasn't found.
-	if err != nil && !k8serrs.IsNotFound(err) {
-		return err
+// reconcileAlerting applies the podinfo PrometheusRule while alerting is enabled, and deletes it otherwise. It is
+// skipped while the PrometheusRule CRD is not installed in the cluster.
+func (r *MyAppResourceReconciler) reconcileAlerting(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileAlerting", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	rule := buildPrometheusRule(myApp)
+	switch {
+	case !r.kindInstalled(rule):
+		if myApp.Spec.Alerting.Enabled {
+			log.V(1).Info("Skipping PrometheusRule, its CRD is not installed", "name", myApp.Name)
+		}
+		return nil
+	case myApp.Spec.Alerting.Enabled:
+		log.V(1).Info("Applying PrometheusRule", "prometheusrule", myApp.Name)
+		return r.apply(ctx, myApp, rule)
 	}
+	return r.deleteIfExists(ctx, myApp, rule, myApp.Name)
+}
 
-	// Service not found, create it.
-	desiredSvc := buildRedisService(myApp)
+// SetupWithManager sets up the controller with the Manager.
+// Every child (the podinfo and Redis Deployments and Services, the Redis StatefulSet, the generated Redis password
+// Secret, the HorizontalPodAutoscaler, the PodDisruptionBudget, the NetworkPolicies, the Ingress, the Gateway API
+// routes and the Prometheus monitors and rule) carries a controller owner-ref back to the MyAppResource, so owning
+// those kinds maps every child event to its parent. Kinds of CRDs not installed at startup are not owned. Secrets are
+// watched rather than owned, so that one watch maps the generated password Secret to its owner and a Secret named by
+// secretRef to the MyAppResources referencing it; see CacheByObject for the Secrets the cache holds.
+func (r *MyAppResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &podinfov1alpha1.MyAppResource{},
+		redisAuthSecretIndex, indexRedisAuthSecret); err != nil {
+		return err
+	}
+	installedKinds, err := detectOptionalKinds(mgr.GetRESTMapper(), r.Scheme)
 	if err != nil {
-		log.V(1).Info("Creating Redis Service", "service", myApp.Name)
-		if err = r.Create(ctx, desiredSvc); err != nil {
+		return err
+	}
+	r.installedKinds = installedKinds
+	r.events = newEventRecorder(r.Recorder)
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&podinfov1alpha1.MyAppResource{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&networkingv1.Ingress{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.findMyAppResourcesForSecret))
+	for _, obj := range optionalKinds {
+		if r.kindInstalled(obj) {
+			builder = builder.Owns(obj)
+			continue
+		}
+		gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+		if err != nil {
+			return err
+		}
+		mgr.GetLogger().Info("CRD not installed, skipping its children", "kind", gvk.Kind, "group", gvk.Group)
+	}
+	return builder.Complete(r)
+}
+
+// reconcileRedis calls create update or delete for the redis application.
+//
+// A persistent redis runs as a StatefulSet governed by a headless Service, any other as a Deployment. Switching
+// between the two deletes the old workload before the new one is applied, so a cache is never split across both.
+//
+// An external redis is not run by the operator, so its own Redis workload and Services are neither applied nor
+// deleted.
+//
+// authHash is the hash of the Redis password, or "" while auth is disabled.
+func (r *MyAppResourceReconciler) reconcileRedis(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource, authHash string,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileRedis", myApp)
+	defer func() { endSpan(span, err) }()
+	if !myApp.Spec.Redis.Enabled {
+		return r.reconcileDeleteRedis(ctx, myApp)
+	}
+	if redisExternal(myApp) != nil {
+		log.FromContext(ctx).V(1).Info("Using external Redis", "address", myApp.Spec.Redis.External.Address)
+		return nil
+	}
+
+	if myApp.Spec.Redis.Persistence.Enabled {
+		if err := r.deleteIfExists(ctx, myApp, &appsv1.Deployment{}, myApp.Name+redisNamePostfix); err != nil {
+			return err
+		} else if err = r.createOrUpdateRedisHeadlessService(ctx, myApp); err != nil {
+			return err
+		} else if err = r.createOrUpdateRedisStatefulSet(ctx, myApp, authHash); err != nil {
+			return err
+		}
+	} else {
+		if err := r.deleteRedisStatefulSet(ctx, myApp); err != nil {
+			return err
+		} else if err = r.createOrUpdateRedisDeployment(ctx, myApp, authHash); err != nil {
 			return err
 		}
 	}
+	return r.createOrUpdateRedisService(ctx, myApp)
+}
 
-	// Service found, update it.
-	// TODO (reedjosh) do a nice comparison and even potentially patch instead of update.
-	log.V(1).Info("Updating Redis Service", "service", desiredSvc.Name)
-	err = r.Update(ctx, desiredSvc)
-	return err
+// createOrUpdateRedisService server-side applies the desired redis service.
+func (r *MyAppResourceReconciler) createOrUpdateRedisService(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "createOrUpdateRedisService", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	log.V(1).Info("Applying Redis Service", "service", myApp.Name+redisNamePostfix)
+	return r.apply(ctx, myApp, buildRedisService(myApp))
 }
 
+// createOrUpdateRedisDeployment server-side applies the desired redis deployment.
 func (r *MyAppResourceReconciler) createOrUpdateRedisDeployment(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource, authHash string,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "createOrUpdateRedisDeployment", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	log.V(1).Info("Applying Redis Deployment", "deployment", myApp.Name+redisNamePostfix)
+	dep := buildRedisDeployment(myApp)
+	setRedisAuthHash(&dep.Spec.Template, authHash)
+	return r.apply(ctx, myApp, dep)
+}
+
+// createOrUpdateRedisHeadlessService server-side applies the desired headless service of a persistent redis.
+func (r *MyAppResourceReconciler) createOrUpdateRedisHeadlessService(
 	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
-) error {
+) (err error) {
+	ctx, span := r.startSpan(ctx, "createOrUpdateRedisHeadlessService", myApp)
+	defer func() { endSpan(span, err) }()
 	log := log.FromContext(ctx)
-	// Fetch existing deployment...
-	foundDep := &appsv1.Deployment{}
-	err := r.Get(ctx, types.NamespacedName{Name: myApp.Name + redisNamePostfix, Namespace: myApp.Namespace}, foundDep)
+	log.V(1).Info("Applying Redis headless Service", "service", myApp.Name+redisHeadlessNamePostfix)
+	return r.apply(ctx, myApp, buildRedisHeadlessService(myApp))
+}
 
-	// Return if err and not just because the deployment wasn't found.
-	if err != nil && !k8serrs.IsNotFound(err) {
-		return err
-	}
+// createOrUpdateRedisStatefulSet server-side applies the desired persistent redis statefulset.
+func (r *MyAppResourceReconciler) createOrUpdateRedisStatefulSet(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource, authHash string,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "createOrUpdateRedisStatefulSet", myApp)
+	defer func() { endSpan(span, err) }()
+	log := log.FromContext(ctx)
+	log.V(1).Info("Applying Redis StatefulSet", "statefulset", myApp.Name+redisNamePostfix)
+	sts := buildRedisStatefulSet(myApp)
+	setRedisAuthHash(&sts.Spec.Template, authHash)
+	return r.apply(ctx, myApp, sts)
+}
 
-	// Deployment not found, create it.
-	desiredDep := buildRedisDeployment(myApp)
-	if err != nil {
-		log.V(1).Info("Creating Redis Deployment", "deployment", myApp.Name+redisNamePostfix)
-		if err = r.Create(ctx, desiredDep); err != nil {
-			return err
-		}
+// deleteRedisStatefulSet removes a persistent redis statefulset and its headless service. The PersistentVolumeClaim
+// is left in place, so re-enabling persistence picks the data back up.
+func (r *MyAppResourceReconciler) deleteRedisStatefulSet(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) error {
+	if err := r.deleteIfExists(ctx, myApp, &appsv1.StatefulSet{}, myApp.Name+redisNamePostfix); err != nil {
+		return err
 	}
-
-	// Deployment found, update it.
-	// TODO (reedjosh) do a nice comparison and even potentially patch instead of update.
-	log.V(1).Info("Updating Redis Deployment", "name", desiredDep.Name+redisNamePostfix)
-	err = r.Update(ctx, desiredDep)
-	return err
+	return r.deleteIfExists(ctx, myApp, &corev1.Service{}, myApp.Name+redisHeadlessNamePostfix)
 }
 
 // reconcileDeleteRedis is necesarry to remove the redis deployment on disablement -- not deletion of the myappresource.
 func (r *MyAppResourceReconciler) reconcileDeleteRedis(
 	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
-) error {
-	log := log.FromContext(ctx)
-	log.V(1).Info("Deleting Redis components")
-	dep := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: myApp.Name + redisNamePostfix, Namespace: myApp.Namespace}}
-	if err := r.Delete(ctx, dep); err != nil && !k8serrs.IsNotFound(err) {
+) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileDeleteRedis", myApp)
+	defer func() { endSpan(span, err) }()
+	if err := r.deleteIfExists(ctx, myApp, &appsv1.Deployment{}, myApp.Name+redisNamePostfix); err != nil {
+		return err
+	} else if err = r.deleteRedisStatefulSet(ctx, myApp); err != nil {
 		return err
 	}
-	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: myApp.Name + redisNamePostfix, Namespace: myApp.Namespace}}
-	if err := r.Delete(ctx, svc); err != nil && !k8serrs.IsNotFound(err) {
+	return r.deleteIfExists(ctx, myApp, &corev1.Service{}, myApp.Name+redisNamePostfix)
+}
+
+// deleteIfExists deletes the named child of myApp of obj's type. Only objects that still exist are deleted, and only
+// if they are children of myApp. Anything else is left alone with a warning event: it is not in the way of what is
+// wanted, which is for the child to be gone.
+func (r *MyAppResourceReconciler) deleteIfExists(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource, obj client.Object, name string,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "deleteIfExists", myApp, attrResourceName.String(name))
+	defer func() { endSpan(span, err) }()
+
+	log := log.FromContext(ctx)
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: myApp.Namespace}, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
 		return err
 	}
+	span.SetAttributes(attrResourceKind.String(gvk.Kind))
+	if !ownedBy(obj, myApp) {
+		log.Info("Leaving an object the myappresource does not own in place", "kind", gvk.Kind, "name", name)
+		r.events.Eventf(myApp, corev1.EventTypeWarning, eventReasonConflict,
+			"Left %s %s in place: it is not controlled by and labelled for the myappresource", gvk.Kind, name)
+		return nil
+	}
+	log.V(1).Info("Deleting "+gvk.Kind, "name", name)
+	uid := obj.GetUID()
+	if err := r.Delete(ctx, obj, client.Preconditions{UID: &uid}); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.recordChildWrite(myApp, writeVerbDelete, gvk.Kind, name)
 	return nil
 }
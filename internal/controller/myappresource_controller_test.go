@@ -18,15 +18,32 @@ package controller
 
 import (
 	"context"
+	"net"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -42,6 +59,68 @@ func performReconcilation(ctx context.Context, namespacedName types.NamespacedNa
 	Expect(err).NotTo(HaveOccurred())
 }
 
+// createOwnedPod creates a pod standing in for one of the running pods of deployment, controlled by a ReplicaSet of
+// it.
+func createOwnedPod(ctx context.Context, deployment *appsv1.Deployment) *corev1.Pod {
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deployment.Name + "-rs",
+			Namespace: deployment.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment")),
+			},
+		},
+		Spec: appsv1.ReplicaSetSpec{Selector: deployment.Spec.Selector, Template: deployment.Spec.Template},
+	}
+	Expect(k8sClient.Create(ctx, replicaSet)).To(Succeed())
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deployment.Name + "-pod",
+			Namespace: deployment.Namespace,
+			Labels:    deployment.Spec.Template.Labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(replicaSet, appsv1.SchemeGroupVersion.WithKind("ReplicaSet")),
+			},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "podinfo", Image: "podinfo"}}},
+	}
+	Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+	DeferCleanup(func() {
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed())
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, replicaSet))).To(Succeed())
+	})
+	return pod
+}
+
+// tearDown deletes the named myappresource, and reconciles its deletion until the finalizer let it go.
+func tearDown(ctx context.Context, namespacedName types.NamespacedName) {
+	installedKinds, err := detectOptionalKinds(k8sClient.RESTMapper(), k8sClient.Scheme())
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	controllerReconciler := &MyAppResourceReconciler{
+		Client:         k8sClient,
+		Scheme:         k8sClient.Scheme(),
+		installedKinds: installedKinds,
+	}
+	myappresource := &podinfov1alpha1.MyAppResource{}
+	ExpectWithOffset(1, k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+	ExpectWithOffset(1, k8sClient.Delete(ctx, myappresource)).To(Succeed())
+	EventuallyWithOffset(1, func(g Gomega) {
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, myappresource))).To(BeTrue())
+	}).Should(Succeed())
+}
+
+// fakeResolver resolves the hosts it maps, and no others.
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if addrs, ok := f[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
 var _ = Describe("MyAppResource Controller", func() {
 	Context("When reconciling a resource", func() {
 		const resourceName = "test-resource"
@@ -90,11 +169,8 @@ var _ = Describe("MyAppResource Controller", func() {
 		})
 
 		AfterEach(func() {
-			resource := &podinfov1alpha1.MyAppResource{}
-			Expect(k8sClient.Get(ctx, namespacedName, resource)).To(Succeed())
-
 			By("Cleanup the specific resource instance MyAppResource")
-			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			tearDown(ctx, namespacedName)
 		})
 
 		It("should successfully reconcile the myappresource", func() {
@@ -154,4 +230,1430 @@ var _ = Describe("MyAppResource Controller", func() {
 			Eventually(k8sClient.Get(ctx, redisNamespacedName, redisDep)).ShouldNot(Succeed())
 		})
 	})
+
+	Context("When reconciling the same resource name in many namespaces", func() {
+		const resourceName = "shared-name"
+
+		ctx := context.Background()
+		namespaces := []string{"team-a", "team-b", "team-c"}
+
+		BeforeEach(func() {
+			for _, ns := range namespaces {
+				By("creating the namespace " + ns)
+				namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}
+				if err := k8sClient.Create(ctx, namespace); err != nil {
+					Expect(errors.IsAlreadyExists(err)).To(BeTrue())
+				}
+
+				By("creating the custom resource for the Kind MyAppResource in " + ns)
+				myappresource := &podinfov1alpha1.MyAppResource{
+					ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: ns},
+					Spec: podinfov1alpha1.MyAppResourceSpec{
+						ReplicaCount: ptr(int32(1)),
+						Image: podinfov1alpha1.Image{
+							Repository: "ghcr.io/stefanprodan/podinfo",
+							Tag:        "latest",
+						},
+						Resources: podinfov1alpha1.Resources{CPURequest: *resource.NewQuantity(100, "m")},
+						UI:        podinfov1alpha1.UI{Message: ns},
+						Redis:     podinfov1alpha1.Redis{Enabled: true},
+					},
+				}
+				Expect(k8sClient.Create(ctx, myappresource)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			for _, ns := range namespaces {
+				By("Cleanup the specific resource instance MyAppResource in " + ns)
+				tearDown(ctx, types.NamespacedName{Name: resourceName, Namespace: ns})
+			}
+		})
+
+		It("should create, update and delete children in each myappresource's own namespace", func() {
+			By("reconciling every namespace's myappresource")
+			for _, ns := range namespaces {
+				performReconcilation(ctx, types.NamespacedName{Name: resourceName, Namespace: ns})
+			}
+
+			for _, ns := range namespaces {
+				By("finding the children of the myappresource in " + ns)
+				namespacedName := types.NamespacedName{Name: resourceName, Namespace: ns}
+				redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: ns}
+				myappresource := &podinfov1alpha1.MyAppResource{}
+				Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+
+				deployment := &appsv1.Deployment{}
+				svc := &corev1.Service{}
+				redisDep := &appsv1.Deployment{}
+				redisSvc := &corev1.Service{}
+				Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+				Expect(k8sClient.Get(ctx, namespacedName, svc)).To(Succeed())
+				Expect(k8sClient.Get(ctx, redisNamespacedName, redisDep)).To(Succeed())
+				Expect(k8sClient.Get(ctx, redisNamespacedName, redisSvc)).To(Succeed())
+
+				By("ensuring each child is owned by the myappresource of its own namespace")
+				for _, obj := range []metav1.Object{deployment, svc, redisDep, redisSvc} {
+					Expect(obj.GetOwnerReferences()[0].UID).To(Equal(myappresource.UID))
+				}
+				Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
+					[]corev1.EnvVar{
+						{Name: "PODINFO_UI_MESSAGE", Value: ns},
+						{
+							Name:  "PODINFO_CACHE_SERVER",
+							Value: "tcp://" + resourceName + redisNamePostfix + "." + ns + ".svc.cluster.local:6379",
+						},
+					},
+				))
+
+				By("updating the myappresource in " + ns)
+				myappresource.Spec.ReplicaCount = ptr(int32(2))
+				myappresource.Spec.Redis.Enabled = false
+				Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			}
+
+			By("reconciling every namespace's updated myappresource")
+			for _, ns := range namespaces {
+				performReconcilation(ctx, types.NamespacedName{Name: resourceName, Namespace: ns})
+			}
+
+			for _, ns := range namespaces {
+				By("verifying the update and redis teardown in " + ns)
+				namespacedName := types.NamespacedName{Name: resourceName, Namespace: ns}
+				redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: ns}
+				deployment := &appsv1.Deployment{}
+				Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+				Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+				Expect(k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{})).ShouldNot(Succeed())
+				Expect(k8sClient.Get(ctx, redisNamespacedName, &corev1.Service{})).ShouldNot(Succeed())
+			}
+		})
+	})
+
+	Context("When autoscaling is enabled", func() {
+		const (
+			resourceName = "autoscaled-resource"
+			namespace    = "autoscaling"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(2)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Resources: podinfov1alpha1.Resources{CPURequest: *resource.NewQuantity(100, "m")},
+					Autoscaling: podinfov1alpha1.Autoscaling{
+						Enabled:                        true,
+						MinReplicas:                    ptr(int32(2)),
+						MaxReplicas:                    6,
+						TargetCPUUtilizationPercentage: ptr(int32(80)),
+					},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should leave the replica count to an owned HorizontalPodAutoscaler", func() {
+			performReconcilation(ctx, namespacedName)
+
+			By("finding the autoscaler targeting the podinfo deployment")
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+			Expect(k8sClient.Get(ctx, namespacedName, hpa)).To(Succeed())
+			Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal(resourceName))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(6)))
+			Expect(hpa.OwnerReferences[0].Name).To(Equal(resourceName))
+
+			By("keeping the replica count the autoscaler chose across reconciles")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			deployment.Spec.Replicas = ptr(int32(5))
+			Expect(k8sClient.Update(ctx, deployment, client.FieldOwner("horizontal-pod-autoscaler"))).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(5)))
+
+			By("deleting the autoscaler and restoring the replica count once autoscaling is disabled")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Autoscaling.Enabled = false
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, hpa))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+		})
+
+		It("should keep the replica count of a running app when autoscaling is turned on", func() {
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Autoscaling.Enabled = false
+			myappresource.Spec.ReplicaCount = ptr(int32(5))
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(5)))
+
+			By("enabling autoscaling before the autoscaler wrote the replica count")
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Autoscaling.Enabled = true
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(5)))
+
+			By("leaving the replica count alone once the autoscaler wrote it")
+			deployment.Spec.Replicas = ptr(int32(3))
+			Expect(k8sClient.Update(ctx, deployment, client.FieldOwner("horizontal-pod-autoscaler"))).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+			Expect(managedByOthers(deployment, "f:spec", "f:replicas")).To(BeTrue())
+		})
+	})
+
+	Context("When podinfo runs several replicas", func() {
+		const (
+			resourceName = "disruption-resource"
+			namespace    = "disruption"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(3)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should own a disruption budget over the podinfo pods until scaled down to one", func() {
+			performReconcilation(ctx, namespacedName)
+
+			By("selecting the podinfo pods, and letting one of them go at a time by default")
+			pdb := &policyv1.PodDisruptionBudget{}
+			Expect(k8sClient.Get(ctx, namespacedName, pdb)).To(Succeed())
+			Expect(pdb.OwnerReferences[0].Name).To(Equal(resourceName))
+			Expect(pdb.Spec.MaxUnavailable).To(Equal(ptr(intstr.FromInt32(1))))
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selector.Matches(labels.Set(deployment.Spec.Template.Labels))).To(BeTrue())
+
+			By("switching to minAvailable")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Disruption.MinAvailable = ptr(intstr.FromString("50%"))
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(k8sClient.Get(ctx, namespacedName, pdb)).To(Succeed())
+			Expect(pdb.Spec.MinAvailable).To(Equal(ptr(intstr.FromString("50%"))))
+			Expect(pdb.Spec.MaxUnavailable).To(BeNil())
+
+			By("deleting the disruption budget once scaled down to a single replica")
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.ReplicaCount = ptr(int32(1))
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, pdb))).To(BeTrue())
+		})
+	})
+
+	Context("When network policies are toggled", func() {
+		const (
+			resourceName = "isolated-resource"
+			namespace    = "network-policy"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+		redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Redis: podinfov1alpha1.Redis{Enabled: true},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should isolate podinfo and redis by default until disabled", func() {
+			performReconcilation(ctx, namespacedName)
+
+			By("owning a policy for podinfo and one for redis")
+			policy, redisPolicy := &networkingv1.NetworkPolicy{}, &networkingv1.NetworkPolicy{}
+			Expect(k8sClient.Get(ctx, namespacedName, policy)).To(Succeed())
+			Expect(k8sClient.Get(ctx, redisNamespacedName, redisPolicy)).To(Succeed())
+			Expect(policy.OwnerReferences[0].Name).To(Equal(resourceName))
+			Expect(redisPolicy.OwnerReferences[0].Name).To(Equal(resourceName))
+
+			By("deleting the redis policy once redis is disabled")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.Enabled = false
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNamespacedName, redisPolicy))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, namespacedName, policy)).To(Succeed())
+
+			By("deleting the podinfo policy once network policies are disabled")
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.NetworkPolicy.Enabled = ptr(false)
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, policy))).To(BeTrue())
+		})
+	})
+
+	Context("When an ingress is configured", func() {
+		const (
+			resourceName = "ingress-resource"
+			namespace    = "ingress"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Ingress: &podinfov1alpha1.Ingress{
+						ClassName:   ptr("nginx"),
+						Annotations: map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "true"},
+						Hosts:       []podinfov1alpha1.IngressHost{{Host: "podinfo.example.com"}},
+						TLS:         []podinfov1alpha1.IngressTLS{{Hosts: []string{"podinfo.example.com"}, SecretName: "podinfo-tls"}},
+					},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should own an ingress to the podinfo service until the block is dropped", func() {
+			performReconcilation(ctx, namespacedName)
+
+			ingress := &networkingv1.Ingress{}
+			Expect(k8sClient.Get(ctx, namespacedName, ingress)).To(Succeed())
+			Expect(ingress.OwnerReferences[0].Name).To(Equal(resourceName))
+			Expect(*ingress.Spec.IngressClassName).To(Equal("nginx"))
+			Expect(ingress.Annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/ssl-redirect", "true"))
+			Expect(ingress.Spec.TLS[0].SecretName).To(Equal("podinfo-tls"))
+			backend := ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+			Expect(backend.Name).To(Equal(resourceName))
+			Expect(backend.Port.Name).To(Equal("http"))
+
+			By("deleting the ingress once spec.ingress is unset")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Ingress = nil
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, ingress))).To(BeTrue())
+		})
+	})
+
+	Context("When a gateway is configured", func() {
+		const (
+			resourceName = "gateway-resource"
+			namespace    = "gateway"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Gateway: &podinfov1alpha1.Gateway{
+						ParentRefs: []gatewayv1.ParentReference{{Name: "public"}},
+						Hostnames:  []gatewayv1.Hostname{"podinfo.example.com"},
+						GRPC:       true,
+					},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should report the routes as not installed without the Gateway API CRDs", func() {
+			performReconcilation(ctx, namespacedName)
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, &gatewayv1.HTTPRoute{}))).To(BeTrue())
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			routesAccepted := meta.FindStatusCondition(myappresource.Status.Conditions,
+				podinfov1alpha1.ConditionRoutesAccepted)
+			Expect(routesAccepted.Reason).To(Equal(reasonCRDNotInstalled))
+		})
+
+		It("should own the routes and report their acceptance", func() {
+			installedKinds, err := detectOptionalKinds(k8sClient.RESTMapper(), k8sClient.Scheme())
+			Expect(err).NotTo(HaveOccurred())
+			controllerReconciler := &MyAppResourceReconciler{
+				Client:         k8sClient,
+				Scheme:         k8sClient.Scheme(),
+				installedKinds: installedKinds,
+			}
+			reconcileGateway := func() {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			routesAccepted := func() *metav1.Condition {
+				myappresource := &podinfov1alpha1.MyAppResource{}
+				Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+				return meta.FindStatusCondition(myappresource.Status.Conditions, podinfov1alpha1.ConditionRoutesAccepted)
+			}
+			reconcileGateway()
+
+			By("applying an http and a grpc route to the podinfo service")
+			httpRoute, grpcRoute := &gatewayv1.HTTPRoute{}, &gatewayv1alpha2.GRPCRoute{}
+			Expect(k8sClient.Get(ctx, namespacedName, httpRoute)).To(Succeed())
+			Expect(k8sClient.Get(ctx, namespacedName, grpcRoute)).To(Succeed())
+			Expect(httpRoute.OwnerReferences[0].Name).To(Equal(resourceName))
+			Expect(*grpcRoute.Spec.Rules[0].BackendRefs[0].Port).To(Equal(gatewayv1.PortNumber(9999)))
+			Expect(routesAccepted().Reason).To(Equal(reasonRoutePending))
+
+			By("reporting the routes accepted once the gateway accepted both")
+			for _, route := range []client.Object{httpRoute, grpcRoute} {
+				status := &httpRoute.Status.RouteStatus
+				if route == grpcRoute {
+					status = &grpcRoute.Status.RouteStatus
+				}
+				status.Parents = []gatewayv1.RouteParentStatus{{
+					ParentRef:      gatewayv1.ParentReference{Name: "public"},
+					ControllerName: "example.com/gateway-controller",
+					Conditions: []metav1.Condition{{
+						Type:               string(gatewayv1.RouteConditionAccepted),
+						Status:             metav1.ConditionTrue,
+						ObservedGeneration: route.GetGeneration(),
+						Reason:             string(gatewayv1.RouteReasonAccepted),
+						LastTransitionTime: metav1.Now(),
+					}},
+				}}
+				Expect(k8sClient.Status().Update(ctx, route)).To(Succeed())
+			}
+			reconcileGateway()
+			Expect(routesAccepted().Status).To(Equal(metav1.ConditionTrue))
+
+			By("deleting the grpc route once it is disabled, and the http route with the gateway block")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Gateway.GRPC = false
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			reconcileGateway()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, grpcRoute))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, namespacedName, httpRoute)).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Gateway = nil
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			reconcileGateway()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, httpRoute))).To(BeTrue())
+			Expect(routesAccepted()).To(BeNil())
+		})
+	})
+
+	Context("When monitoring is enabled", func() {
+		const (
+			resourceName = "monitoring-resource"
+			namespace    = "monitoring"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Monitoring: podinfov1alpha1.Monitoring{
+						Enabled: true,
+						Kind:    podinfov1alpha1.MonitoringServiceMonitor,
+						Labels:  map[string]string{"release": "prometheus"},
+					},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should skip the monitor without the prometheus-operator CRDs", func() {
+			performReconcilation(ctx, namespacedName)
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, &monitoringv1.ServiceMonitor{}))).To(BeTrue())
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, namespacedName, service)).To(Succeed())
+			Expect(service.Spec.Ports).To(ContainElement(HaveField("Name", "http-metrics")))
+		})
+
+		It("should own the configured monitor kind until monitoring is disabled", func() {
+			installedKinds, err := detectOptionalKinds(k8sClient.RESTMapper(), k8sClient.Scheme())
+			Expect(err).NotTo(HaveOccurred())
+			controllerReconciler := &MyAppResourceReconciler{
+				Client:         k8sClient,
+				Scheme:         k8sClient.Scheme(),
+				installedKinds: installedKinds,
+			}
+			reconcileMonitoring := func() {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			updateMonitoring := func(monitoring podinfov1alpha1.Monitoring) {
+				myappresource := &podinfov1alpha1.MyAppResource{}
+				Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+				myappresource.Spec.Monitoring = monitoring
+				Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			}
+			reconcileMonitoring()
+
+			By("applying a servicemonitor for the podinfo service")
+			serviceMonitor, podMonitor := &monitoringv1.ServiceMonitor{}, &monitoringv1.PodMonitor{}
+			Expect(k8sClient.Get(ctx, namespacedName, serviceMonitor)).To(Succeed())
+			Expect(serviceMonitor.OwnerReferences[0].Name).To(Equal(resourceName))
+			Expect(serviceMonitor.Labels).To(HaveKeyWithValue("release", "prometheus"))
+			Expect(serviceMonitor.Spec.Endpoints[0].Port).To(Equal("http-metrics"))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, podMonitor))).To(BeTrue())
+
+			By("replacing it with a podmonitor when the kind changes")
+			updateMonitoring(podinfov1alpha1.Monitoring{Enabled: true, Kind: podinfov1alpha1.MonitoringPodMonitor})
+			reconcileMonitoring()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, serviceMonitor))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, namespacedName, podMonitor)).To(Succeed())
+			Expect(podMonitor.OwnerReferences[0].Name).To(Equal(resourceName))
+
+			By("deleting the podmonitor and the metrics port once monitoring is disabled")
+			updateMonitoring(podinfov1alpha1.Monitoring{})
+			reconcileMonitoring()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, podMonitor))).To(BeTrue())
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, namespacedName, service)).To(Succeed())
+			Expect(service.Spec.Ports).NotTo(ContainElement(HaveField("Name", "http-metrics")))
+		})
+	})
+
+	Context("When alerting is enabled", func() {
+		const (
+			resourceName = "alerting-resource"
+			namespace    = "alerting"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Alerting: podinfov1alpha1.Alerting{
+						Enabled:          true,
+						ErrorRatePercent: ptr(int32(5)),
+						For:              "5m",
+					},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should skip the rule without the prometheus-operator CRDs", func() {
+			performReconcilation(ctx, namespacedName)
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, &monitoringv1.PrometheusRule{}))).To(BeTrue())
+		})
+
+		It("should own a prometheusrule until alerting is disabled", func() {
+			installedKinds, err := detectOptionalKinds(k8sClient.RESTMapper(), k8sClient.Scheme())
+			Expect(err).NotTo(HaveOccurred())
+			controllerReconciler := &MyAppResourceReconciler{
+				Client:         k8sClient,
+				Scheme:         k8sClient.Scheme(),
+				installedKinds: installedKinds,
+			}
+			reconcileAlerting := func() {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			reconcileAlerting()
+
+			rule := &monitoringv1.PrometheusRule{}
+			Expect(k8sClient.Get(ctx, namespacedName, rule)).To(Succeed())
+			Expect(rule.OwnerReferences[0].Name).To(Equal(resourceName))
+			Expect(rule.Spec.Groups[0].Rules).To(ContainElement(HaveField("Alert", "PodinfoUnavailable")))
+
+			By("deleting the prometheusrule once alerting is disabled")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Alerting.Enabled = false
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			reconcileAlerting()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, rule))).To(BeTrue())
+		})
+	})
+
+	Context("When redis persistence is toggled", func() {
+		const (
+			resourceName = "persistent-resource"
+			namespace    = "redis-persistence"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+		redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: namespace}
+		headlessNamespacedName := types.NamespacedName{Name: resourceName + redisHeadlessNamePostfix, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Redis: podinfov1alpha1.Redis{Enabled: true},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		// setPersistence toggles redis persistence on the myappresource and reconciles it.
+		setPersistence := func(enabled bool) {
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.Persistence = podinfov1alpha1.RedisPersistence{
+				Enabled: enabled,
+				Size:    resource.MustParse("1Gi"),
+				Mode:    podinfov1alpha1.RedisPersistenceAOF,
+			}
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+		}
+
+		It("should migrate redis between a deployment and a statefulset", func() {
+			performReconcilation(ctx, namespacedName)
+			redisSvc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, redisNamespacedName, redisSvc)).To(Succeed())
+			Expect(k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{})).To(Succeed())
+
+			By("replacing the redis deployment with a statefulset once persistence is enabled")
+			setPersistence(true)
+			deployment := &appsv1.Deployment{}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, redisNamespacedName, deployment)
+				return errors.IsNotFound(err) || deployment.DeletionTimestamp != nil
+			}).Should(BeTrue())
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisNamespacedName, sts)).To(Succeed())
+			Expect(sts.Spec.VolumeClaimTemplates).To(HaveLen(1))
+			Expect(k8sClient.Get(ctx, headlessNamespacedName, &corev1.Service{})).To(Succeed())
+
+			By("leaving the unchanged statefulset alone on the next reconcile")
+			skipped := testutil.ToFloat64(childApplyTotal.WithLabelValues("StatefulSet", applyResultSkipped))
+			performReconcilation(ctx, namespacedName)
+			Expect(testutil.ToFloat64(childApplyTotal.WithLabelValues("StatefulSet", applyResultSkipped))).
+				To(Equal(skipped + 1))
+
+			By("keeping the redis service podinfo connects to")
+			migratedSvc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, redisNamespacedName, migratedSvc)).To(Succeed())
+			Expect(migratedSvc.UID).To(Equal(redisSvc.UID))
+			Expect(migratedSvc.Spec.Selector).To(Equal(sts.Spec.Template.Labels))
+
+			By("going back to a deployment once persistence is disabled")
+			setPersistence(false)
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, redisNamespacedName, sts)
+				return errors.IsNotFound(err) || sts.DeletionTimestamp != nil
+			}).Should(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, headlessNamespacedName, &corev1.Service{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{})).To(Succeed())
+		})
+	})
+
+	Context("When redis auth is enabled", func() {
+		const (
+			resourceName = "authenticated-resource"
+			namespace    = "redis-auth"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+		redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: namespace}
+		secretNamespacedName := types.NamespacedName{Name: resourceName + redisAuthNamePostfix, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Redis: podinfov1alpha1.Redis{Enabled: true, Auth: podinfov1alpha1.RedisAuth{Enabled: true}},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		// authHashes returns the redis auth hash of the podinfo and the redis pod templates.
+		authHashes := func() (string, string) {
+			deployment, redisDep := &appsv1.Deployment{}, &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(k8sClient.Get(ctx, redisNamespacedName, redisDep)).To(Succeed())
+			return deployment.Spec.Template.Annotations[redisAuthHashAnnotation],
+				redisDep.Spec.Template.Annotations[redisAuthHashAnnotation]
+		}
+
+		It("should generate, rotate and hand over the redis password", func() {
+			performReconcilation(ctx, namespacedName)
+
+			By("generating a password into an owned secret")
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, secretNamespacedName, secret)).To(Succeed())
+			Expect(secret.Data["password"]).To(HaveLen(64))
+			Expect(secret.OwnerReferences[0].Name).To(Equal(resourceName))
+			password := string(secret.Data["password"])
+			podinfoHash, redisHash := authHashes()
+			Expect(podinfoHash).NotTo(BeEmpty())
+			Expect(redisHash).To(Equal(podinfoHash))
+
+			By("keeping the generated password across reconciles")
+			performReconcilation(ctx, namespacedName)
+			Expect(k8sClient.Get(ctx, secretNamespacedName, secret)).To(Succeed())
+			Expect(string(secret.Data["password"])).To(Equal(password))
+
+			By("rolling both deployments out together when the password is rotated")
+			secret.Data["password"] = []byte("rotated")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			rotatedPodinfoHash, rotatedRedisHash := authHashes()
+			Expect(rotatedPodinfoHash).NotTo(Equal(podinfoHash))
+			Expect(rotatedRedisHash).To(Equal(rotatedPodinfoHash))
+
+			By("failing the reconcile while a referenced secret is missing")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.Auth.SecretRef = &podinfov1alpha1.SecretKeyReference{Name: "shared-redis", Key: "pw"}
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			controllerReconciler := &MyAppResourceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).To(MatchError(ContainSubstring("shared-redis")))
+			Expect(err).To(MatchError(ContainSubstring(podinfov1alpha1.MyAppResourceLabelName)))
+
+			By("switching to the referenced secret and deleting the generated one")
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "shared-redis",
+					Namespace: namespace,
+					Labels:    map[string]string{podinfov1alpha1.MyAppResourceLabelName: resourceName},
+				},
+				Data: map[string][]byte{"pw": []byte("shared")},
+			})).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, secretNamespacedName, secret))).To(BeTrue())
+			redisDep := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, redisNamespacedName, redisDep)).To(Succeed())
+			Expect(redisDep.Spec.Template.Spec.Containers[0].Env[0].ValueFrom.SecretKeyRef.Name).To(Equal("shared-redis"))
+		})
+	})
+
+	Context("When redis is external", func() {
+		const (
+			resourceName = "external-resource"
+			namespace    = "redis-external"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+		redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Redis: podinfov1alpha1.Redis{Enabled: true},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+		})
+
+		It("should leave the operator's redis alone and report whether the address resolved", func() {
+			resolver := fakeResolver{}
+			controllerReconciler := &MyAppResourceReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Resolver: resolver,
+			}
+			performReconcilation(ctx, namespacedName)
+			Expect(k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{})).To(Succeed())
+
+			By("switching to an external redis whose address does not resolve")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.External = &podinfov1alpha1.RedisExternal{Address: "cache.example.com", Port: 6379}
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(externalRedisRequeueInterval))
+
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			redisReady := meta.FindStatusCondition(myappresource.Status.Conditions, podinfov1alpha1.ConditionRedisReady)
+			Expect(redisReady.Status).To(Equal(metav1.ConditionFalse))
+			Expect(redisReady.Reason).To(Equal(reasonEndpointUnresolved))
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+				corev1.EnvVar{Name: "PODINFO_CACHE_SERVER", Value: "tcp://cache.example.com:6379"}))
+
+			By("keeping the operator's redis deployment and service")
+			Expect(k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{})).To(Succeed())
+			Expect(k8sClient.Get(ctx, redisNamespacedName, &corev1.Service{})).To(Succeed())
+
+			By("reporting redis ready once the address resolves")
+			resolver["cache.example.com"] = []string{"192.0.2.10"}
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(myappresource.Status.Conditions, podinfov1alpha1.ConditionRedisReady)).
+				To(BeTrue())
+		})
+	})
+
+	Context("When a child's name is already taken", func() {
+		const (
+			resourceName = "taken-resource"
+			namespace    = "ownership"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+		redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			tearDown(ctx, namespacedName)
+			for _, name := range []string{resourceName, resourceName + redisNamePostfix} {
+				svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, svc))).To(Succeed())
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + redisAuthNamePostfix, Namespace: namespace},
+			}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, secret))).To(Succeed())
+		})
+
+		It("should leave the object alone until it is annotated for adoption", func() {
+			By("creating a service of the same name before the myappresource")
+			foreign := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: namespace,
+					Labels:    map[string]string{"app": "someone-else"},
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "someone-else"},
+					Ports:    []corev1.ServicePort{{Name: "web", Port: 8080}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+				},
+			})).To(Succeed())
+
+			controllerReconciler := &MyAppResourceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(conflictRequeueInterval))
+
+			By("reporting the conflict, leaving the service untouched and reconciling the rest")
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			conflict := meta.FindStatusCondition(myappresource.Status.Conditions, podinfov1alpha1.ConditionConflict)
+			Expect(conflict.Status).To(Equal(metav1.ConditionTrue))
+			Expect(conflict.Message).To(ContainSubstring(podinfov1alpha1.MyAppResourceAdoptAnnotation))
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, namespacedName, svc)).To(Succeed())
+			Expect(svc.OwnerReferences).To(BeEmpty())
+			Expect(svc.Spec.Selector).To(Equal(map[string]string{"app": "someone-else"}))
+			Expect(k8sClient.Get(ctx, namespacedName, &networkingv1.NetworkPolicy{})).To(Succeed())
+
+			By("adopting the service once it is annotated for the myappresource")
+			svc.Annotations = map[string]string{podinfov1alpha1.MyAppResourceAdoptAnnotation: resourceName}
+			Expect(k8sClient.Update(ctx, svc)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(k8sClient.Get(ctx, namespacedName, svc)).To(Succeed())
+			Expect(metav1.IsControlledBy(svc, myappresource)).To(BeTrue())
+			Expect(svc.Labels).To(HaveKeyWithValue(podinfov1alpha1.MyAppResourceLabelName, resourceName))
+			Expect(svc.Spec.Selector).To(Equal(selectorLabels(myappresource)))
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(myappresource.Status.Conditions, podinfov1alpha1.ConditionConflict)).
+				To(BeTrue())
+		})
+
+		It("should leave an object it does not own in place when its child is disabled, and reconcile the rest", func() {
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+				},
+			})).To(Succeed())
+			Expect(k8sClient.Create(ctx, &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + redisNamePostfix, Namespace: namespace},
+				Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "redis", Port: 6379}}},
+			})).To(Succeed())
+
+			recorder := record.NewFakeRecorder(100)
+			controllerReconciler := &MyAppResourceReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+				events: newEventRecorder(recorder),
+			}
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(k8sClient.Get(ctx, redisNamespacedName, &corev1.Service{})).To(Succeed())
+			Expect(drainEvents(recorder)).To(ContainElement(
+				"Warning Conflict Left Service " + resourceName + redisNamePostfix +
+					" in place: it is not controlled by and labelled for the myappresource"))
+
+			By("reconciling every other child without reporting a conflict")
+			Expect(k8sClient.Get(ctx, namespacedName, &appsv1.Deployment{})).To(Succeed())
+			Expect(k8sClient.Get(ctx, namespacedName, &networkingv1.NetworkPolicy{})).To(Succeed())
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(myappresource.Status.Conditions, podinfov1alpha1.ConditionConflict)).
+				To(BeTrue())
+		})
+
+		It("should not use a redis password secret it does not own", func() {
+			secretNamespacedName := types.NamespacedName{Name: resourceName + redisAuthNamePostfix, Namespace: namespace}
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: secretNamespacedName.Name, Namespace: namespace},
+				Data:       map[string][]byte{podinfov1alpha1.DefaultSecretKey: []byte("someone-elses")},
+			})).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(1)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Redis: podinfov1alpha1.Redis{Enabled: true, Auth: podinfov1alpha1.RedisAuth{Enabled: true}},
+				},
+			})).To(Succeed())
+
+			controllerReconciler := &MyAppResourceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(conflictRequeueInterval))
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			conflict := meta.FindStatusCondition(myappresource.Status.Conditions, podinfov1alpha1.ConditionConflict)
+			Expect(conflict.Status).To(Equal(metav1.ConditionTrue))
+			Expect(conflict.Message).To(ContainSubstring(secretNamespacedName.Name))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, &appsv1.Deployment{}))).To(BeTrue())
+
+			By("not deleting it once auth is disabled, even when it names the myappresource as controller")
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, secretNamespacedName, secret)).To(Succeed())
+			secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(myappresource,
+				podinfov1alpha1.GroupVersion.WithKind("MyAppResource"))}
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+			myappresource.Spec.Redis.Auth.Enabled = false
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(k8sClient.Get(ctx, secretNamespacedName, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue(podinfov1alpha1.DefaultSecretKey, []byte("someone-elses")))
+		})
+	})
+
+	Context("When a myappresource is deleted", func() {
+		const (
+			resourceName = "deleted-resource"
+			namespace    = "teardown"
+		)
+
+		ctx := context.Background()
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+		redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: namespace}
+
+		BeforeEach(func() {
+			namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(2)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Redis: podinfov1alpha1.Redis{Enabled: true},
+				},
+			})).To(Succeed())
+		})
+
+		It("should drain podinfo, then remove redis and the other labelled children", func() {
+			performReconcilation(ctx, namespacedName)
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			Expect(myappresource.Finalizers).To(ContainElement(podinfov1alpha1.MyAppResourceFinalizer))
+
+			By("standing in for a running podinfo pod, and an ingress the operator did not create")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			pod := createOwnedPod(ctx, deployment)
+			foreignIngress := &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: networkingv1.IngressSpec{DefaultBackend: &networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{
+						Name: "elsewhere", Port: networkingv1.ServiceBackendPort{Number: 80},
+					},
+				}},
+			}
+			Expect(k8sClient.Create(ctx, foreignIngress)).To(Succeed())
+
+			By("scaling podinfo to zero and waiting for its pods")
+			Expect(k8sClient.Delete(ctx, myappresource)).To(Succeed())
+			controllerReconciler := &MyAppResourceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(teardownRequeueInterval))
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(BeZero())
+			Expect(k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{})).To(Succeed())
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			terminating := meta.FindStatusCondition(myappresource.Status.Conditions, podinfov1alpha1.ConditionTerminating)
+			Expect(terminating.Reason).To(Equal(reasonScalingDown))
+			Expect(terminating.Message).To(ContainSubstring("1 podinfo pods"))
+			Expect(meta.IsStatusConditionFalse(myappresource.Status.Conditions, podinfov1alpha1.ConditionReady)).
+				To(BeTrue())
+
+			By("removing redis and the remaining children once the pods are gone")
+			Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, myappresource))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNamespacedName, &corev1.Service{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, &appsv1.Deployment{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, &corev1.Service{}))).To(BeTrue())
+
+			By("leaving the ingress without the myappresource label alone")
+			Expect(k8sClient.Get(ctx, namespacedName, foreignIngress)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, foreignIngress)).To(Succeed())
+		})
+
+		It("should not wait on the pods of workloads it does not own", func() {
+			performReconcilation(ctx, namespacedName)
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+
+			By("handing the podinfo and redis deployments to someone else, with a pod each")
+			var foreign []*appsv1.Deployment
+			for _, key := range []types.NamespacedName{namespacedName, redisNamespacedName} {
+				deployment := &appsv1.Deployment{}
+				Expect(k8sClient.Get(ctx, key, deployment)).To(Succeed())
+				deployment.OwnerReferences = nil
+				delete(deployment.Labels, podinfov1alpha1.MyAppResourceLabelName)
+				Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+				createOwnedPod(ctx, deployment)
+				foreign = append(foreign, deployment)
+			}
+
+			By("letting the myappresource go without scaling or waiting on them")
+			Expect(k8sClient.Delete(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, myappresource))).To(BeTrue())
+			for _, deployment := range foreign {
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+				Expect(*deployment.Spec.Replicas).NotTo(BeZero())
+				Expect(k8sClient.Delete(ctx, deployment)).To(Succeed())
+			}
+		})
+
+		It("should keep the claims of a persistent redis unless asked to delete them", func() {
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.Persistence = podinfov1alpha1.RedisPersistence{
+				Enabled: true,
+				Size:    resource.MustParse("1Gi"),
+				Mode:    podinfov1alpha1.RedisPersistenceAOF,
+			}
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisNamespacedName, sts)).To(Succeed())
+			kept := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisDataVolume + "-" + redisNamespacedName.Name + "-0",
+					Namespace: namespace,
+					Labels:    sts.Spec.VolumeClaimTemplates[0].Labels,
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, kept)).To(Succeed())
+
+			Expect(k8sClient.Delete(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, myappresource))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(kept), kept)).To(Succeed())
+			Expect(kept.DeletionTimestamp).To(BeNil())
+			// Nothing in envtest releases the claim's protection finalizer, so drop it along with the claim.
+			kept.Finalizers = nil
+			Expect(k8sClient.Update(ctx, kept)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, kept)).To(Succeed())
+		})
+
+		It("should delete the claims of a persistent redis with deleteClaims", func() {
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.Persistence = podinfov1alpha1.RedisPersistence{
+				Enabled:      true,
+				Size:         resource.MustParse("1Gi"),
+				Mode:         podinfov1alpha1.RedisPersistenceAOF,
+				DeleteClaims: true,
+			}
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisNamespacedName, sts)).To(Succeed())
+			Expect(sts.Spec.VolumeClaimTemplates[0].Labels).To(
+				HaveKeyWithValue(podinfov1alpha1.MyAppResourceLabelName, resourceName))
+
+			By("standing in for the claim the statefulset created, and one of the same name pattern it did not")
+			claim := func(name string, labels map[string]string) *corev1.PersistentVolumeClaim {
+				pvc := &corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, pvc)).To(Succeed())
+				return pvc
+			}
+			owned := claim(redisDataVolume+"-"+redisNamespacedName.Name+"-0", sts.Spec.VolumeClaimTemplates[0].Labels)
+			foreign := claim(redisDataVolume+"-"+redisNamespacedName.Name+"-1", nil)
+
+			Expect(k8sClient.Delete(ctx, myappresource)).To(Succeed())
+			performReconcilation(ctx, namespacedName)
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, myappresource))).To(BeTrue())
+			// Claims are protected by a finalizer until no pod uses them, so a deleted one may linger.
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(owned), owned)
+			Expect(errors.IsNotFound(err) || err == nil && owned.DeletionTimestamp != nil).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(foreign), foreign)).To(Succeed())
+			Expect(foreign.DeletionTimestamp).To(BeNil())
+		})
+	})
+
+	Context("When the controller is running under a manager", Ordered, func() {
+		const (
+			resourceName = "watched-resource"
+			namespace    = "watched"
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+		redisNamespacedName := types.NamespacedName{Name: resourceName + redisNamePostfix, Namespace: namespace}
+
+		BeforeAll(func() {
+			By("creating the namespace " + namespace)
+			Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+			By("starting a manager that only caches the " + namespace + " namespace and its redis password secrets")
+			cacheByObject, err := CacheByObject()
+			Expect(err).NotTo(HaveOccurred())
+			mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+				Scheme:  k8sClient.Scheme(),
+				Metrics: metricsserver.Options{BindAddress: "0"},
+				Cache: cache.Options{
+					DefaultNamespaces: map[string]cache.Config{namespace: {}},
+					ByObject:          cacheByObject,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect((&MyAppResourceReconciler{
+				Client: mgr.GetClient(),
+				Scheme: mgr.GetScheme(),
+			}).SetupWithManager(mgr)).To(Succeed())
+			go func() {
+				defer GinkgoRecover()
+				Expect(mgr.Start(ctx)).To(Succeed())
+			}()
+
+			By("creating the custom resource for the Kind MyAppResource")
+			Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+				Spec: podinfov1alpha1.MyAppResourceSpec{
+					ReplicaCount: ptr(int32(2)),
+					Image: podinfov1alpha1.Image{
+						Repository: "ghcr.io/stefanprodan/podinfo",
+						Tag:        "latest",
+					},
+					Resources: podinfov1alpha1.Resources{CPURequest: *resource.NewQuantity(100, "m")},
+					Redis:     podinfov1alpha1.Redis{Enabled: true},
+				},
+			})).To(Succeed())
+		})
+
+		AfterAll(func() {
+			By("stopping the manager")
+			cancel()
+		})
+
+		It("should create every child without being requeued", func() {
+			Eventually(func() error { return k8sClient.Get(ctx, namespacedName, &appsv1.Deployment{}) }).Should(Succeed())
+			Eventually(func() error { return k8sClient.Get(ctx, namespacedName, &corev1.Service{}) }).Should(Succeed())
+			Eventually(func() error { return k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{}) }).Should(Succeed())
+			Eventually(func() error { return k8sClient.Get(ctx, redisNamespacedName, &corev1.Service{}) }).Should(Succeed())
+		})
+
+		It("should recreate a child that was deleted by hand", func() {
+			redisSvc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, redisNamespacedName, redisSvc)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, redisSvc)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				recreated := &corev1.Service{}
+				g.Expect(k8sClient.Get(ctx, redisNamespacedName, recreated)).To(Succeed())
+				g.Expect(recreated.UID).NotTo(Equal(redisSvc.UID))
+			}).Should(Succeed())
+		})
+
+		It("should revert drift of a child", func() {
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			deployment.Spec.Replicas = ptr(int32(5))
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+				g.Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+			}).Should(Succeed())
+		})
+
+		It("should update the status when the deployment's readiness changes", func() {
+			By("reporting progress while nothing has rolled out")
+			Eventually(func(g Gomega) {
+				myappresource := &podinfov1alpha1.MyAppResource{}
+				g.Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+				g.Expect(myappresource.Status.ObservedGeneration).To(Equal(myappresource.Generation))
+				g.Expect(meta.IsStatusConditionTrue(myappresource.Status.Conditions, podinfov1alpha1.ConditionProgressing)).
+					To(BeTrue())
+				g.Expect(meta.IsStatusConditionFalse(myappresource.Status.Conditions, podinfov1alpha1.ConditionReady)).
+					To(BeTrue())
+			}).Should(Succeed())
+
+			By("marking both deployments rolled out, as the deployment controller would")
+			for _, name := range []types.NamespacedName{namespacedName, redisNamespacedName} {
+				deployment := &appsv1.Deployment{}
+				Expect(k8sClient.Get(ctx, name, deployment)).To(Succeed())
+				deployment.Status = rolledOutDeployment(name.Name, *deployment.Spec.Replicas).Status
+				deployment.Status.ObservedGeneration = deployment.Generation
+				Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+			}
+
+			Eventually(func(g Gomega) {
+				myappresource := &podinfov1alpha1.MyAppResource{}
+				g.Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+				g.Expect(myappresource.Status.Ready).To(BeTrue())
+				g.Expect(meta.IsStatusConditionTrue(myappresource.Status.Conditions, podinfov1alpha1.ConditionReady)).
+					To(BeTrue())
+				g.Expect(meta.IsStatusConditionTrue(myappresource.Status.Conditions, podinfov1alpha1.ConditionRedisReady)).
+					To(BeTrue())
+			}).Should(Succeed())
+		})
+
+		It("should scale the podinfo deployment through the scale subresource", func() {
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+
+			By("reading the current scale")
+			scale := &autoscalingv1.Scale{}
+			Expect(k8sClient.SubResource("scale").Get(ctx, myappresource, scale)).To(Succeed())
+			Expect(scale.Spec.Replicas).To(Equal(int32(2)))
+			Expect(scale.Status.Replicas).To(Equal(int32(2)))
+			Expect(scale.Status.Selector).To(Equal("app.kubernetes.io/name=" + resourceName))
+
+			By("scaling the myappresource to 3 replicas")
+			scale.Spec.Replicas = 3
+			Expect(k8sClient.SubResource("scale").Update(ctx, myappresource, client.WithSubResourceBody(scale))).
+				To(Succeed())
+
+			Eventually(func(g Gomega) {
+				deployment := &appsv1.Deployment{}
+				g.Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+				g.Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+			}).Should(Succeed())
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			Expect(myappresource.Status.Image).To(Equal("ghcr.io/stefanprodan/podinfo:latest"))
+		})
+
+		It("should read and rotate the redis password through the cache of labelled secrets", func() {
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			myappresource.Spec.Redis.Auth.Enabled = true
+			Expect(k8sClient.Update(ctx, myappresource)).To(Succeed())
+
+			By("reading the generated password through the cache")
+			authHash := func(g Gomega) string {
+				deployment := &appsv1.Deployment{}
+				g.Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+				return deployment.Spec.Template.Annotations[redisAuthHashAnnotation]
+			}
+			var generatedHash string
+			Eventually(func(g Gomega) {
+				generatedHash = authHash(g)
+				g.Expect(generatedHash).NotTo(BeEmpty())
+			}).Should(Succeed())
+
+			By("rolling the deployment out when the password is rotated")
+			secret := &corev1.Secret{}
+			secretNamespacedName := types.NamespacedName{Name: resourceName + redisAuthNamePostfix, Namespace: namespace}
+			Expect(k8sClient.Get(ctx, secretNamespacedName, secret)).To(Succeed())
+			secret.Data[podinfov1alpha1.DefaultSecretKey] = []byte("rotated")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+			Eventually(func(g Gomega) {
+				g.Expect(authHash(g)).NotTo(Equal(generatedHash))
+			}).Should(Succeed())
+		})
+
+		It("should remove every child before letting a deleted myappresource go", func() {
+			myappresource := &podinfov1alpha1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, namespacedName, myappresource)).To(Succeed())
+			Expect(myappresource.Finalizers).To(ContainElement(podinfov1alpha1.MyAppResourceFinalizer))
+			Expect(k8sClient.Delete(ctx, myappresource)).To(Succeed())
+
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, namespacedName, myappresource))
+			}).Should(BeTrue())
+			// Nothing garbage collects owned objects in envtest, so these were deleted by the teardown itself.
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, &appsv1.Deployment{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, namespacedName, &corev1.Service{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNamespacedName, &appsv1.Deployment{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNamespacedName, &corev1.Service{}))).To(BeTrue())
+		})
+	})
 })
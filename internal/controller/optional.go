@@ -0,0 +1,71 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// optionalKinds are child kinds whose CRDs are not part of every cluster. They are looked up once at startup; a
+// child of a kind that is not installed is never applied, deleted or watched.
+var optionalKinds = []client.Object{
+	&gatewayv1.HTTPRoute{},
+	&gatewayv1alpha2.GRPCRoute{},
+	&monitoringv1.ServiceMonitor{},
+	&monitoringv1.PodMonitor{},
+	&monitoringv1.PrometheusRule{},
+}
+
+// detectOptionalKinds returns the GroupVersionKinds of the optionalKinds served by the cluster.
+func detectOptionalKinds(mapper meta.RESTMapper, scheme *runtime.Scheme) (map[schema.GroupVersionKind]bool, error) {
+	installed := map[schema.GroupVersionKind]bool{}
+	for _, obj := range optionalKinds {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			return nil, err
+		}
+		_, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		installed[gvk] = true
+	}
+	return installed, nil
+}
+
+// kindInstalled reports whether obj's kind was found at startup. Kinds that are not optional are always installed.
+func (r *MyAppResourceReconciler) kindInstalled(obj client.Object) bool {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return false
+	}
+	for _, optional := range optionalKinds {
+		if optionalGVK, _ := apiutil.GVKForObject(optional, r.Scheme); optionalGVK == gvk {
+			return r.installedKinds[gvk]
+		}
+	}
+	return true
+}
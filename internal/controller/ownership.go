@@ -0,0 +1,74 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// conflictRequeueInterval is how long a myappresource with a conflicting child waits before checking again. The
+// conflicting object is not owned, so none of its changes are watched.
+const conflictRequeueInterval = time.Minute
+
+// conflictError reports an existing object the operator refused to write, because it is not a child of the
+// myappresource.
+type conflictError struct {
+	kind, name, reason string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("%s %s is not owned by this myappresource: %s", e.kind, e.name, e.reason)
+}
+
+// isConflict reports whether err is, or wraps, a conflictError.
+func isConflict(err error) bool {
+	var conflict *conflictError
+	return errors.As(err, &conflict)
+}
+
+// ownedBy reports whether obj is a child of myApp: controlled by it, and carrying its MyAppResource label.
+func ownedBy(obj client.Object, myApp *podinfov1alpha1.MyAppResource) bool {
+	return metav1.IsControlledBy(obj, myApp) && obj.GetLabels()[podinfov1alpha1.MyAppResourceLabelName] == myApp.Name
+}
+
+// checkApplyOwnership returns a conflictError unless the observed object may be overwritten by desired. That is the
+// case for an object already controlled by the owner of desired, which the apply then labels if it was not yet, and
+// for an object without a controller that was annotated for adoption by the owner.
+func checkApplyOwnership(kind string, desired, observed client.Object) error {
+	owner := metav1.GetControllerOf(desired)
+	if owner == nil {
+		return nil
+	}
+	switch controller := metav1.GetControllerOf(observed); {
+	case controller != nil && controller.UID == owner.UID:
+		return nil
+	case controller != nil:
+		return &conflictError{kind, observed.GetName(),
+			fmt.Sprintf("it is controlled by %s %s", controller.Kind, controller.Name)}
+	case observed.GetAnnotations()[podinfov1alpha1.MyAppResourceAdoptAnnotation] == owner.Name:
+		return nil
+	}
+	return &conflictError{kind, observed.GetName(), fmt.Sprintf(
+		"annotate it with %s=%s to adopt it", podinfov1alpha1.MyAppResourceAdoptAnnotation, owner.Name)}
+}
@@ -0,0 +1,461 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// Condition reasons set by the operator itself. Reasons copied from the child Deployment's own conditions are
+// passed through unchanged.
+const (
+	reasonDeploymentNotFound  = "DeploymentNotFound"
+	reasonStatefulSetNotFound = "StatefulSetNotFound"
+	reasonRolloutPending      = "RolloutPending"
+	reasonRollingOut          = "RollingOut"
+	reasonRolloutComplete     = "RolloutComplete"
+	reasonDeploymentHealthy   = "DeploymentHealthy"
+	reasonRedisNotReady       = "RedisNotReady"
+	reasonEndpointResolved    = "EndpointResolved"
+	reasonEndpointUnresolved  = "EndpointUnresolved"
+	reasonCRDNotInstalled     = "CRDNotInstalled"
+	reasonRouteNotFound       = "RouteNotFound"
+	reasonRoutePending        = "RoutePending"
+	reasonRoutesAccepted      = "Accepted"
+	reasonReconcileFailed     = "ReconcileFailed"
+	reasonReconcileSucceeded  = "ReconcileSucceeded"
+	reasonTerminating         = "Terminating"
+	reasonChildNotOwned       = "ChildNotOwned"
+	reasonNoConflict          = "NoConflict"
+	reasonScalingDown         = "ScalingDown"
+	reasonRemovingRedis       = "RemovingRedis"
+	reasonRemovingChildren    = "RemovingChildren"
+)
+
+// updateStatus rolls the observed state of the child deployments and the outcome of the reconcile up into the
+// myApp status, records the transitions as events and the status as metrics, and patches only the resulting diff.
+func (r *MyAppResourceReconciler) updateStatus(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource, reconcileErr error,
+) (err error) {
+	ctx, span := r.startSpan(ctx, "updateStatus", myApp)
+	defer func() { endSpan(span, err) }()
+	original := myApp.DeepCopy()
+
+	dep, err := r.getDeployment(ctx, myApp.Name, myApp.Namespace)
+	if err != nil {
+		return err
+	}
+	var redis client.Object
+	var resolveErr error
+	if external := redisExternal(myApp); external != nil {
+		resolveErr = r.resolveRedisExternal(ctx, external)
+	} else if myApp.Spec.Redis.Enabled {
+		if redis, err = r.getRedis(ctx, myApp); err != nil {
+			return err
+		}
+	}
+
+	routes, err := r.getRoutes(ctx, myApp)
+	if err != nil {
+		return err
+	}
+
+	setStatusConditions(myApp, dep, redis, resolveErr, reconcileErr)
+	setRoutesAcceptedCondition(myApp, routes)
+	setStatusScale(myApp, dep)
+	r.recordStatusEvents(original, myApp, reconcileErr)
+	recordStatusMetrics(original, myApp, dep)
+	if equality.Semantic.DeepEqual(original.Status, myApp.Status) {
+		return nil
+	}
+	if err := r.Status().Patch(ctx, myApp, client.MergeFrom(original)); err != nil {
+		return fmt.Errorf("error patching myappresource status: %w", err)
+	}
+	return nil
+}
+
+// getDeployment returns the named deployment, or nil if it does not exist.
+func (r *MyAppResourceReconciler) getDeployment(ctx context.Context, name, namespace string) (*appsv1.Deployment, error) {
+	dep := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, dep)
+	if k8serrs.IsNotFound(err) {
+		return nil, nil
+	}
+	return dep, err
+}
+
+// getRedis returns the redis deployment, or the redis statefulset while persistence is enabled. The returned object
+// is a nil *appsv1.Deployment or *appsv1.StatefulSet if the workload does not exist.
+func (r *MyAppResourceReconciler) getRedis(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (client.Object, error) {
+	key := types.NamespacedName{Name: myApp.Name + redisNamePostfix, Namespace: myApp.Namespace}
+	if !myApp.Spec.Redis.Persistence.Enabled {
+		return r.getDeployment(ctx, key.Name, key.Namespace)
+	}
+	sts := &appsv1.StatefulSet{}
+	err := r.Get(ctx, key, sts)
+	if k8serrs.IsNotFound(err) {
+		return (*appsv1.StatefulSet)(nil), nil
+	}
+	return sts, err
+}
+
+// observedRoute is the observed state of a podinfo Gateway API route.
+type observedRoute struct {
+	kind       string
+	installed  bool
+	generation int64
+	// status is nil when the route does not exist.
+	status *gatewayv1.RouteStatus
+}
+
+// getRoutes returns the observed state of the routes spec.gateway asks for.
+func (r *MyAppResourceReconciler) getRoutes(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) ([]observedRoute, error) {
+	if myApp.Spec.Gateway == nil {
+		return nil, nil
+	}
+	type routeRef struct {
+		kind   string
+		obj    client.Object
+		status *gatewayv1.RouteStatus
+	}
+	httpRoute := &gatewayv1.HTTPRoute{}
+	routes := []routeRef{{"HTTPRoute", httpRoute, &httpRoute.Status.RouteStatus}}
+	if myApp.Spec.Gateway.GRPC {
+		grpcRoute := &gatewayv1alpha2.GRPCRoute{}
+		routes = append(routes, routeRef{"GRPCRoute", grpcRoute, &grpcRoute.Status.RouteStatus})
+	}
+
+	key := types.NamespacedName{Name: myApp.Name, Namespace: myApp.Namespace}
+	observed := make([]observedRoute, 0, len(routes))
+	for _, route := range routes {
+		o := observedRoute{kind: route.kind, installed: r.kindInstalled(route.obj)}
+		if o.installed {
+			err := r.Get(ctx, key, route.obj)
+			if err != nil && !k8serrs.IsNotFound(err) {
+				return nil, err
+			} else if err == nil {
+				o.generation, o.status = route.obj.GetGeneration(), route.status
+			}
+		}
+		observed = append(observed, o)
+	}
+	return observed, nil
+}
+
+// setStatusConditions computes every MyAppResource condition from the observed workloads. dep may be nil when the
+// deployment does not exist (yet); redis is the redis Deployment or StatefulSet, or nil when it does not exist.
+// resolveErr is the outcome of looking up the address of an external redis.
+func setStatusConditions(
+	myApp *podinfov1alpha1.MyAppResource, dep *appsv1.Deployment, redis client.Object,
+	resolveErr, reconcileErr error,
+) {
+	status := &myApp.Status
+	generation := myApp.Generation
+	set := func(condType string, condStatus metav1.ConditionStatus, reason, message string) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               condType,
+			Status:             condStatus,
+			ObservedGeneration: generation,
+			Reason:             reason,
+			Message:            message,
+		})
+	}
+
+	// Reconcile outcome.
+	if reconcileErr != nil {
+		set(podinfov1alpha1.ConditionReconcileError, metav1.ConditionTrue, reasonReconcileFailed, reconcileErr.Error())
+	} else {
+		set(podinfov1alpha1.ConditionReconcileError, metav1.ConditionFalse, reasonReconcileSucceeded, "")
+	}
+
+	// Children left alone because an object the myApp does not own holds their name.
+	if isConflict(reconcileErr) {
+		set(podinfov1alpha1.ConditionConflict, metav1.ConditionTrue, reasonChildNotOwned, reconcileErr.Error())
+	} else {
+		set(podinfov1alpha1.ConditionConflict, metav1.ConditionFalse, reasonNoConflict, "")
+	}
+
+	// Podinfo deployment degradation, straight from the deployment's own conditions.
+	degraded := deploymentDegradedCondition(dep)
+	if degraded != nil {
+		set(podinfov1alpha1.ConditionDegraded, metav1.ConditionTrue, degraded.Reason, degraded.Message)
+	} else {
+		set(podinfov1alpha1.ConditionDegraded, metav1.ConditionFalse, reasonDeploymentHealthy, "")
+	}
+
+	// Podinfo deployment rollout.
+	rolledOut, reason, message := deploymentRolloutStatus(dep)
+	switch {
+	case rolledOut:
+		set(podinfov1alpha1.ConditionProgressing, metav1.ConditionFalse, reason, message)
+	case degraded != nil:
+		set(podinfov1alpha1.ConditionProgressing, metav1.ConditionFalse, degraded.Reason, degraded.Message)
+	default:
+		set(podinfov1alpha1.ConditionProgressing, metav1.ConditionTrue, reason, message)
+	}
+
+	// Redis deployment rollout, only reported while Redis is enabled.
+	redisReady := true
+	if myApp.Spec.Redis.Enabled {
+		var redisReason, redisMessage string
+		if external := redisExternal(myApp); external != nil {
+			redisReady, redisReason, redisMessage = externalRedisStatus(external, resolveErr)
+		} else {
+			redisReady, redisReason, redisMessage = redisRolloutStatus(redis)
+		}
+		if redisReady {
+			set(podinfov1alpha1.ConditionRedisReady, metav1.ConditionTrue, redisReason, redisMessage)
+		} else {
+			set(podinfov1alpha1.ConditionRedisReady, metav1.ConditionFalse, redisReason, redisMessage)
+		}
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, podinfov1alpha1.ConditionRedisReady)
+	}
+
+	// Overall readiness.
+	switch {
+	case reconcileErr != nil:
+		set(podinfov1alpha1.ConditionReady, metav1.ConditionFalse, reasonReconcileFailed, reconcileErr.Error())
+	case !rolledOut:
+		set(podinfov1alpha1.ConditionReady, metav1.ConditionFalse, reason, message)
+	case !redisReady:
+		set(podinfov1alpha1.ConditionReady, metav1.ConditionFalse, reasonRedisNotReady, "redis is not ready")
+	default:
+		set(podinfov1alpha1.ConditionReady, metav1.ConditionTrue, reason, message)
+	}
+
+	status.Ready = meta.IsStatusConditionTrue(status.Conditions, podinfov1alpha1.ConditionReady)
+	status.ObservedGeneration = generation
+}
+
+// setRoutesAcceptedCondition reports whether every parent of the podinfo routes accepted the latest generation of
+// them. The condition is removed while spec.gateway is unset.
+func setRoutesAcceptedCondition(myApp *podinfov1alpha1.MyAppResource, routes []observedRoute) {
+	if myApp.Spec.Gateway == nil {
+		meta.RemoveStatusCondition(&myApp.Status.Conditions, podinfov1alpha1.ConditionRoutesAccepted)
+		return
+	}
+	accepted, reason, message := routesAcceptedStatus(myApp, routes)
+	condStatus := metav1.ConditionFalse
+	if accepted {
+		condStatus = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&myApp.Status.Conditions, metav1.Condition{
+		Type:               podinfov1alpha1.ConditionRoutesAccepted,
+		Status:             condStatus,
+		ObservedGeneration: myApp.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// routesAcceptedStatus reports the first route not accepted by one of the spec.gateway parents, if any.
+func routesAcceptedStatus(myApp *podinfov1alpha1.MyAppResource, routes []observedRoute) (bool, string, string) {
+	for _, route := range routes {
+		switch {
+		case !route.installed:
+			return false, reasonCRDNotInstalled, fmt.Sprintf("the %s CRD is not installed", route.kind)
+		case route.status == nil:
+			return false, reasonRouteNotFound, fmt.Sprintf("waiting for the %s to be created", route.kind)
+		}
+		for _, parentRef := range myApp.Spec.Gateway.ParentRefs {
+			parent := findRouteParentStatus(route.status, parentRef, myApp.Namespace)
+			var cond *metav1.Condition
+			if parent != nil {
+				cond = meta.FindStatusCondition(parent.Conditions, string(gatewayv1.RouteConditionAccepted))
+			}
+			switch {
+			case cond == nil || cond.ObservedGeneration < route.generation:
+				return false, reasonRoutePending, fmt.Sprintf(
+					"waiting for parent %s to accept the %s", parentRef.Name, route.kind)
+			case cond.Status != metav1.ConditionTrue:
+				return false, cond.Reason, fmt.Sprintf(
+					"%s not accepted by parent %s: %s", route.kind, parentRef.Name, cond.Message)
+			}
+		}
+	}
+	return true, reasonRoutesAccepted, "routes accepted by every parent"
+}
+
+// findRouteParentStatus returns the route status reported for parentRef, if any. The namespace of a parentRef
+// defaults to the route's namespace.
+func findRouteParentStatus(
+	status *gatewayv1.RouteStatus, parentRef gatewayv1.ParentReference, namespace string,
+) *gatewayv1.RouteParentStatus {
+	refNamespace := func(ref gatewayv1.ParentReference) string {
+		if ref.Namespace != nil {
+			return string(*ref.Namespace)
+		}
+		return namespace
+	}
+	for i, parent := range status.Parents {
+		if parent.ParentRef.Name == parentRef.Name &&
+			refNamespace(parent.ParentRef) == refNamespace(parentRef) &&
+			equality.Semantic.DeepEqual(parent.ParentRef.SectionName, parentRef.SectionName) {
+			return &status.Parents[i]
+		}
+	}
+	return nil
+}
+
+// setStatusScale reports the replicas, pod selector and image of the podinfo deployment, backing the scale
+// subresource and the printer columns. dep may be nil when the deployment does not exist (yet).
+func setStatusScale(myApp *podinfov1alpha1.MyAppResource, dep *appsv1.Deployment) {
+	status := &myApp.Status
+	status.Selector = labels.SelectorFromSet(selectorLabels(myApp)).String()
+	status.Replicas = 0
+	status.Image = ""
+	if dep == nil {
+		return
+	}
+	status.Replicas = dep.Status.Replicas
+	for _, container := range dep.Spec.Template.Spec.Containers {
+		if container.Name == "podinfo" {
+			status.Image = container.Image
+		}
+	}
+}
+
+// deploymentRolloutStatus mirrors `kubectl rollout status`: a deployment is rolled out once the deployment controller
+// has observed its latest generation and every desired replica is updated and available.
+func deploymentRolloutStatus(dep *appsv1.Deployment) (bool, string, string) {
+	if dep == nil {
+		return false, reasonDeploymentNotFound, "waiting for the deployment to be created"
+	}
+	if dep.Status.ObservedGeneration < dep.Generation {
+		return false, reasonRolloutPending, fmt.Sprintf(
+			"waiting for deployment %s generation %d to be observed", dep.Name, dep.Generation)
+	}
+
+	desired := int32(1)
+	if dep.Spec.Replicas != nil {
+		desired = *dep.Spec.Replicas
+	}
+	switch {
+	case dep.Status.UpdatedReplicas < desired:
+		return false, reasonRollingOut, fmt.Sprintf(
+			"%d of %d replicas of deployment %s updated", dep.Status.UpdatedReplicas, desired, dep.Name)
+	case dep.Status.Replicas > dep.Status.UpdatedReplicas:
+		return false, reasonRollingOut, fmt.Sprintf(
+			"%d old replicas of deployment %s pending termination",
+			dep.Status.Replicas-dep.Status.UpdatedReplicas, dep.Name)
+	case dep.Status.AvailableReplicas < dep.Status.UpdatedReplicas:
+		return false, reasonRollingOut, fmt.Sprintf(
+			"%d of %d updated replicas of deployment %s available",
+			dep.Status.AvailableReplicas, dep.Status.UpdatedReplicas, dep.Name)
+	}
+
+	// Prefer the deployment's own explanation when it has one.
+	if available := getDeploymentCondition(dep, appsv1.DeploymentAvailable); available != nil &&
+		available.Reason != "" {
+		return true, available.Reason, available.Message
+	}
+	return true, reasonRolloutComplete, fmt.Sprintf("deployment %s successfully rolled out", dep.Name)
+}
+
+// redisRolloutStatus reports the rollout of the redis Deployment or StatefulSet. A nil redis is reported as a missing
+// deployment.
+func redisRolloutStatus(redis client.Object) (bool, string, string) {
+	if sts, ok := redis.(*appsv1.StatefulSet); ok {
+		return statefulSetRolloutStatus(sts)
+	}
+	dep, _ := redis.(*appsv1.Deployment)
+	return deploymentRolloutStatus(dep)
+}
+
+// externalRedisStatus reports whether the address of an external redis resolved.
+func externalRedisStatus(external *podinfov1alpha1.RedisExternal, resolveErr error) (bool, string, string) {
+	if resolveErr != nil {
+		return false, reasonEndpointUnresolved, fmt.Sprintf(
+			"external redis address %s did not resolve: %v", external.Address, resolveErr)
+	}
+	return true, reasonEndpointResolved, fmt.Sprintf("external redis address %s resolved", external.Address)
+}
+
+// statefulSetRolloutStatus mirrors `kubectl rollout status` for a statefulset with the RollingUpdate strategy: it is
+// rolled out once the statefulset controller has observed its latest generation, every desired replica is ready and
+// every pod runs the update revision.
+func statefulSetRolloutStatus(sts *appsv1.StatefulSet) (bool, string, string) {
+	if sts == nil {
+		return false, reasonStatefulSetNotFound, "waiting for the statefulset to be created"
+	}
+	if sts.Status.ObservedGeneration < sts.Generation {
+		return false, reasonRolloutPending, fmt.Sprintf(
+			"waiting for statefulset %s generation %d to be observed", sts.Name, sts.Generation)
+	}
+
+	desired := int32(1)
+	if sts.Spec.Replicas != nil {
+		desired = *sts.Spec.Replicas
+	}
+	switch {
+	case sts.Status.ReadyReplicas < desired:
+		return false, reasonRollingOut, fmt.Sprintf(
+			"%d of %d replicas of statefulset %s ready", sts.Status.ReadyReplicas, desired, sts.Name)
+	case sts.Status.UpdateRevision != sts.Status.CurrentRevision:
+		return false, reasonRollingOut, fmt.Sprintf(
+			"%d of %d replicas of statefulset %s updated", sts.Status.UpdatedReplicas, desired, sts.Name)
+	}
+	return true, reasonRolloutComplete, fmt.Sprintf("statefulset %s successfully rolled out", sts.Name)
+}
+
+// deploymentDegradedCondition returns the deployment condition explaining why it is degraded, if any.
+func deploymentDegradedCondition(dep *appsv1.Deployment) *appsv1.DeploymentCondition {
+	if dep == nil {
+		return nil
+	}
+	if cond := getDeploymentCondition(dep, appsv1.DeploymentReplicaFailure); cond != nil &&
+		cond.Status == corev1.ConditionTrue && cond.Reason != "" {
+		return cond
+	}
+	if cond := getDeploymentCondition(dep, appsv1.DeploymentProgressing); cond != nil &&
+		cond.Status == corev1.ConditionFalse && cond.Reason != "" {
+		return cond
+	}
+	return nil
+}
+
+// getDeploymentCondition returns the deployment condition of the given type, if present.
+func getDeploymentCondition(
+	dep *appsv1.Deployment, condType appsv1.DeploymentConditionType,
+) *appsv1.DeploymentCondition {
+	for i := range dep.Status.Conditions {
+		if dep.Status.Conditions[i].Type == condType {
+			return &dep.Status.Conditions[i]
+		}
+	}
+	return nil
+}
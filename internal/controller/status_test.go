@@ -0,0 +1,276 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// rolledOutDeployment returns a deployment whose status reports a completed rollout of replicas.
+func rolledOutDeployment(name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr(replicas)},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			ReadyReplicas:      replicas,
+			AvailableReplicas:  replicas,
+			Conditions: []appsv1.DeploymentCondition{
+				{
+					Type:    appsv1.DeploymentAvailable,
+					Status:  corev1.ConditionTrue,
+					Reason:  "MinimumReplicasAvailable",
+					Message: "Deployment has minimum availability.",
+				},
+				{
+					Type:    appsv1.DeploymentProgressing,
+					Status:  corev1.ConditionTrue,
+					Reason:  "NewReplicaSetAvailable",
+					Message: "ReplicaSet has successfully progressed.",
+				},
+			},
+		},
+	}
+}
+
+var _ = Describe("MyAppResource Status Conditions", func() {
+	var myApp *podinfov1alpha1.MyAppResource
+
+	BeforeEach(func() {
+		myApp = &podinfov1alpha1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-resource", Namespace: "default", Generation: 4},
+			Spec:       podinfov1alpha1.MyAppResourceSpec{ReplicaCount: ptr(int32(2))},
+		}
+	})
+
+	It("should report ready once the deployment has rolled out", func() {
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil, nil, nil)
+
+		Expect(myApp.Status.Ready).To(BeTrue())
+		Expect(myApp.Status.ObservedGeneration).To(Equal(int64(4)))
+		ready := meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionReady)
+		Expect(ready.Status).To(Equal(metav1.ConditionTrue))
+		Expect(ready.Reason).To(Equal("MinimumReplicasAvailable"))
+		Expect(ready.ObservedGeneration).To(Equal(int64(4)))
+		Expect(meta.IsStatusConditionFalse(myApp.Status.Conditions, podinfov1alpha1.ConditionProgressing)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(myApp.Status.Conditions, podinfov1alpha1.ConditionDegraded)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(myApp.Status.Conditions, podinfov1alpha1.ConditionReconcileError)).To(BeTrue())
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady)).To(BeNil())
+	})
+
+	It("should report progressing while the deployment is rolling out", func() {
+		dep := rolledOutDeployment("test-resource", 2)
+		dep.Status.UpdatedReplicas = 1
+		setStatusConditions(myApp, dep, nil, nil, nil)
+
+		Expect(myApp.Status.Ready).To(BeFalse())
+		progressing := meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionProgressing)
+		Expect(progressing.Status).To(Equal(metav1.ConditionTrue))
+		Expect(progressing.Reason).To(Equal(reasonRollingOut))
+		Expect(progressing.Message).To(ContainSubstring("1 of 2 replicas"))
+	})
+
+	It("should report progressing until the deployment generation is observed", func() {
+		dep := rolledOutDeployment("test-resource", 2)
+		dep.Generation = 3
+		setStatusConditions(myApp, dep, nil, nil, nil)
+
+		Expect(myApp.Status.Ready).To(BeFalse())
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionReady).Reason).
+			To(Equal(reasonRolloutPending))
+	})
+
+	It("should report degraded with the deployment's own reason when the rollout stalls", func() {
+		dep := rolledOutDeployment("test-resource", 2)
+		dep.Status.AvailableReplicas = 0
+		dep.Status.Conditions[1] = appsv1.DeploymentCondition{
+			Type:    appsv1.DeploymentProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: `ReplicaSet "test-resource-abc" has timed out progressing.`,
+		}
+		setStatusConditions(myApp, dep, nil, nil, nil)
+
+		degraded := meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionDegraded)
+		Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+		Expect(degraded.Reason).To(Equal("ProgressDeadlineExceeded"))
+		Expect(degraded.Message).To(ContainSubstring("timed out progressing"))
+		Expect(meta.IsStatusConditionFalse(myApp.Status.Conditions, podinfov1alpha1.ConditionProgressing)).To(BeTrue())
+		Expect(myApp.Status.Ready).To(BeFalse())
+	})
+
+	It("should hold ready until redis is ready when enabled", func() {
+		myApp.Spec.Redis.Enabled = true
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil, nil, nil)
+
+		Expect(myApp.Status.Ready).To(BeFalse())
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionReady).Reason).
+			To(Equal(reasonRedisNotReady))
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady).Reason).
+			To(Equal(reasonDeploymentNotFound))
+
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2),
+			rolledOutDeployment("test-resource-redis", 1), nil, nil)
+		Expect(myApp.Status.Ready).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady)).To(BeTrue())
+
+		By("dropping the redis condition once redis is disabled")
+		myApp.Spec.Redis.Enabled = false
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil, nil, nil)
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady)).To(BeNil())
+	})
+
+	It("should report reconcile errors", func() {
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil, nil, errors.New("boom"))
+
+		Expect(myApp.Status.Ready).To(BeFalse())
+		reconcileErr := meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionReconcileError)
+		Expect(reconcileErr.Status).To(Equal(metav1.ConditionTrue))
+		Expect(reconcileErr.Message).To(Equal("boom"))
+	})
+
+	It("should report children the myappresource does not own as a conflict", func() {
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil, nil,
+			&conflictError{"Service", "test-resource", "it is controlled by Helm test-resource"})
+		conflict := meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionConflict)
+		Expect(conflict.Status).To(Equal(metav1.ConditionTrue))
+		Expect(conflict.Reason).To(Equal(reasonChildNotOwned))
+		Expect(conflict.Message).To(ContainSubstring("Service test-resource"))
+
+		By("clearing the conflict once the children reconcile")
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil, nil, nil)
+		Expect(meta.IsStatusConditionFalse(myApp.Status.Conditions, podinfov1alpha1.ConditionConflict)).To(BeTrue())
+	})
+
+	It("should report the podinfo deployment's replicas, selector and image", func() {
+		setStatusScale(myApp, nil)
+		Expect(myApp.Status.Selector).To(Equal("app.kubernetes.io/name=test-resource"))
+		Expect(myApp.Status.Replicas).To(BeZero())
+		Expect(myApp.Status.Image).To(BeEmpty())
+
+		dep := rolledOutDeployment("test-resource", 3)
+		dep.Spec.Template.Spec.Containers = []corev1.Container{
+			{Name: "sidecar", Image: "busybox"},
+			{Name: "podinfo", Image: "ghcr.io/stefanprodan/podinfo:6.5.4"},
+		}
+		setStatusScale(myApp, dep)
+		Expect(myApp.Status.Replicas).To(Equal(int32(3)))
+		Expect(myApp.Status.Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.4"))
+	})
+	It("should report redis readiness from the statefulset while persistence is enabled", func() {
+		myApp.Spec.Redis.Enabled = true
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-resource-redis", Generation: 1},
+			Spec:       appsv1.StatefulSetSpec{Replicas: ptr(int32(1))},
+			Status: appsv1.StatefulSetStatus{
+				ObservedGeneration: 1,
+				ReadyReplicas:      1,
+				CurrentRevision:    "redis-1",
+				UpdateRevision:     "redis-2",
+			},
+		}
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), sts, nil, nil)
+		Expect(myApp.Status.Ready).To(BeFalse())
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady).Reason).
+			To(Equal(reasonRollingOut))
+
+		sts.Status.CurrentRevision = "redis-2"
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), sts, nil, nil)
+		Expect(myApp.Status.Ready).To(BeTrue())
+
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), (*appsv1.StatefulSet)(nil), nil, nil)
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady).Reason).
+			To(Equal(reasonStatefulSetNotFound))
+	})
+	It("should report redis readiness from the address of an external redis", func() {
+		myApp.Spec.Redis = podinfov1alpha1.Redis{
+			Enabled:  true,
+			External: &podinfov1alpha1.RedisExternal{Address: "cache.example.com"},
+		}
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil,
+			errors.New("no such host"), nil)
+		Expect(myApp.Status.Ready).To(BeFalse())
+		redisReady := meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady)
+		Expect(redisReady.Reason).To(Equal(reasonEndpointUnresolved))
+		Expect(redisReady.Message).To(ContainSubstring("no such host"))
+
+		setStatusConditions(myApp, rolledOutDeployment("test-resource", 2), nil, nil, nil)
+		Expect(myApp.Status.Ready).To(BeTrue())
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRedisReady).Reason).
+			To(Equal(reasonEndpointResolved))
+	})
+	It("should report whether every gateway accepted the routes", func() {
+		myApp.Spec.Gateway = &podinfov1alpha1.Gateway{
+			ParentRefs: []gatewayv1.ParentReference{{Name: "public"}, {Name: "internal", SectionName: ptr(gatewayv1.SectionName("http"))}},
+		}
+		accepted := func(name string, sectionName *gatewayv1.SectionName, status metav1.ConditionStatus) gatewayv1.RouteParentStatus {
+			return gatewayv1.RouteParentStatus{
+				ParentRef:      gatewayv1.ParentReference{Name: gatewayv1.ObjectName(name), SectionName: sectionName},
+				ControllerName: "example.com/gateway-controller",
+				Conditions: []metav1.Condition{{
+					Type:               string(gatewayv1.RouteConditionAccepted),
+					Status:             status,
+					ObservedGeneration: 1,
+					Reason:             "NotAllowedByListeners",
+					Message:            "listener does not allow the route",
+				}},
+			}
+		}
+		reason := func(routes ...observedRoute) string {
+			setRoutesAcceptedCondition(myApp, routes)
+			return meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRoutesAccepted).Reason
+		}
+
+		Expect(reason(observedRoute{kind: "HTTPRoute"})).To(Equal(reasonCRDNotInstalled))
+		Expect(reason(observedRoute{kind: "HTTPRoute", installed: true})).To(Equal(reasonRouteNotFound))
+
+		route := observedRoute{kind: "HTTPRoute", installed: true, generation: 1, status: &gatewayv1.RouteStatus{
+			Parents: []gatewayv1.RouteParentStatus{accepted("public", nil, metav1.ConditionTrue)},
+		}}
+		Expect(reason(route)).To(Equal(reasonRoutePending))
+
+		route.status.Parents = append(route.status.Parents,
+			accepted("internal", ptr(gatewayv1.SectionName("http")), metav1.ConditionFalse))
+		Expect(reason(route)).To(Equal("NotAllowedByListeners"))
+
+		route.status.Parents[1].Conditions[0].Status = metav1.ConditionTrue
+		Expect(reason(route)).To(Equal(reasonRoutesAccepted))
+		Expect(meta.IsStatusConditionTrue(myApp.Status.Conditions, podinfov1alpha1.ConditionRoutesAccepted)).To(BeTrue())
+
+		By("waiting for the parents to observe a new generation of the route")
+		route.generation = 2
+		Expect(reason(route)).To(Equal(reasonRoutePending))
+
+		By("dropping the condition once spec.gateway is unset")
+		myApp.Spec.Gateway = nil
+		setRoutesAcceptedCondition(myApp, nil)
+		Expect(meta.FindStatusCondition(myApp.Status.Conditions, podinfov1alpha1.ConditionRoutesAccepted)).To(BeNil())
+	})
+})
@@ -0,0 +1,296 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// teardownRequeueInterval is how long a teardown waiting for pods to terminate waits before checking again. Pods are
+// not watched, so nothing else would trigger the next check.
+const teardownRequeueInterval = 5 * time.Second
+
+// child names a child resource of a MyAppResource.
+type child struct {
+	obj  client.Object
+	name string
+}
+
+// redisChildren returns every child making up the operator's Redis, whichever of them exist.
+func redisChildren(myApp *podinfov1alpha1.MyAppResource) []child {
+	return []child{
+		{&appsv1.Deployment{}, myApp.Name + redisNamePostfix},
+		{&appsv1.StatefulSet{}, myApp.Name + redisNamePostfix},
+		{&corev1.Service{}, myApp.Name + redisNamePostfix},
+		{&corev1.Service{}, myApp.Name + redisHeadlessNamePostfix},
+		{&networkingv1.NetworkPolicy{}, myApp.Name + redisNamePostfix},
+		{&corev1.Secret{}, myApp.Name + redisAuthNamePostfix},
+	}
+}
+
+// podinfoChildren returns every child of myApp other than its Redis, whichever of them exist.
+func podinfoChildren(myApp *podinfov1alpha1.MyAppResource) []child {
+	return []child{
+		{&autoscalingv2.HorizontalPodAutoscaler{}, myApp.Name},
+		{&appsv1.Deployment{}, myApp.Name},
+		{&corev1.Service{}, myApp.Name},
+		{&policyv1.PodDisruptionBudget{}, myApp.Name},
+		{&networkingv1.NetworkPolicy{}, myApp.Name},
+		{&networkingv1.Ingress{}, myApp.Name},
+		{&gatewayv1.HTTPRoute{}, myApp.Name},
+		{&gatewayv1alpha2.GRPCRoute{}, myApp.Name},
+		{&monitoringv1.ServiceMonitor{}, myApp.Name},
+		{&monitoringv1.PodMonitor{}, myApp.Name},
+		{&monitoringv1.PrometheusRule{}, myApp.Name},
+	}
+}
+
+// reconcileDelete tears down the children of a deleted myApp in order: podinfo is scaled to zero and its pods are
+// left to terminate, then Redis is, then Redis and every other child are removed along with the Redis data. Only
+// children of myApp, controlled by it and carrying its MyAppResource label, are scaled or deleted, and only the pods
+// of those are waited on. The finalizer is removed once the teardown is done; until then the Terminating condition
+// reports the step in progress.
+func (r *MyAppResourceReconciler) reconcileDelete(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource,
+) (res ctrl.Result, err error) {
+	ctx, span := r.startSpan(ctx, "reconcileDelete", myApp)
+	defer func() { endSpan(span, err) }()
+	if !controllerutil.ContainsFinalizer(myApp, podinfov1alpha1.MyAppResourceFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	// The autoscaler would scale podinfo back up, so it goes first. podinfo stops before Redis does, so no request is
+	// served without its cache.
+	if err := r.deleteOwned(ctx, myApp, child{&autoscalingv2.HorizontalPodAutoscaler{}, myApp.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+	podinfo, err := r.scaleDown(ctx, myApp, child{&appsv1.Deployment{}, myApp.Name})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if pods, err := r.countOwnedPods(ctx, myApp.Namespace, podinfo...); err != nil {
+		return ctrl.Result{}, err
+	} else if pods > 0 {
+		return ctrl.Result{RequeueAfter: teardownRequeueInterval}, r.setTerminatingCondition(ctx, myApp,
+			reasonScalingDown, fmt.Sprintf("waiting for %d podinfo pods to terminate", pods))
+	}
+
+	var redis []client.Object
+	for _, c := range []child{
+		{&appsv1.Deployment{}, myApp.Name + redisNamePostfix},
+		{&appsv1.StatefulSet{}, myApp.Name + redisNamePostfix},
+	} {
+		workload, err := r.scaleDown(ctx, myApp, c)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		redis = append(redis, workload...)
+	}
+	if pods, err := r.countOwnedPods(ctx, myApp.Namespace, redis...); err != nil {
+		return ctrl.Result{}, err
+	} else if pods > 0 {
+		return ctrl.Result{RequeueAfter: teardownRequeueInterval}, r.setTerminatingCondition(ctx, myApp,
+			reasonRemovingRedis, fmt.Sprintf("waiting for %d redis pods to terminate", pods))
+	}
+
+	if err := r.setTerminatingCondition(ctx, myApp, reasonRemovingChildren, "removing the children"); err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, c := range append(redisChildren(myApp), podinfoChildren(myApp)...) {
+		if err := r.deleteOwned(ctx, myApp, c); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if myApp.Spec.Redis.Persistence.DeleteClaims {
+		if err := r.deleteRedisClaims(ctx, myApp); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	log.FromContext(ctx).V(1).Info("Teardown complete, removing finalizer", "name", myApp.Name)
+	original := myApp.DeepCopy()
+	controllerutil.RemoveFinalizer(myApp, podinfov1alpha1.MyAppResourceFinalizer)
+	if err := r.Patch(ctx, myApp, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	r.events.forget(myApp.UID)
+	deleteAppMetrics(client.ObjectKeyFromObject(myApp))
+	return ctrl.Result{}, nil
+}
+
+// ensureFinalizer adds the MyAppResourceFinalizer to myApp, so its deletion waits for reconcileDelete.
+func (r *MyAppResourceReconciler) ensureFinalizer(ctx context.Context, myApp *podinfov1alpha1.MyAppResource) error {
+	if controllerutil.ContainsFinalizer(myApp, podinfov1alpha1.MyAppResourceFinalizer) {
+		return nil
+	}
+	original := myApp.DeepCopy()
+	controllerutil.AddFinalizer(myApp, podinfov1alpha1.MyAppResourceFinalizer)
+	return r.Patch(ctx, myApp, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+}
+
+// scaleDown scales the named Deployment or StatefulSet of myApp to zero replicas, and returns it, if it exists and
+// is myApp's. A workload myApp does not own is left alone, and nothing returned.
+func (r *MyAppResourceReconciler) scaleDown(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource, c child,
+) ([]client.Object, error) {
+	if err := r.Get(ctx, types.NamespacedName{Name: c.name, Namespace: myApp.Namespace}, c.obj); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if !ownedBy(c.obj, myApp) {
+		log.FromContext(ctx).Info("Leaving a workload the myappresource does not own running", "name", c.name)
+		return nil, nil
+	}
+	original := c.obj.DeepCopyObject().(client.Object)
+	var replicas **int32
+	switch workload := c.obj.(type) {
+	case *appsv1.Deployment:
+		replicas = &workload.Spec.Replicas
+	case *appsv1.StatefulSet:
+		replicas = &workload.Spec.Replicas
+	}
+	if *replicas != nil && **replicas == 0 {
+		return []client.Object{c.obj}, nil
+	}
+	log.FromContext(ctx).V(1).Info("Scaling workload to zero", "name", c.name)
+	zero := int32(0)
+	*replicas = &zero
+	return []client.Object{c.obj}, r.Patch(ctx, c.obj, client.MergeFrom(original))
+}
+
+// countOwnedPods returns the number of pods in namespace, terminating or not, controlled by one of workloads, either
+// directly or through a ReplicaSet. Only their metadata is read, so the pods and ReplicaSets cached to answer this
+// stay small.
+func (r *MyAppResourceReconciler) countOwnedPods(
+	ctx context.Context, namespace string, workloads ...client.Object,
+) (int, error) {
+	if len(workloads) == 0 {
+		return 0, nil
+	}
+	owners := sets.New[types.UID]()
+	for _, workload := range workloads {
+		owners.Insert(workload.GetUID())
+	}
+	replicaSets := &metav1.PartialObjectMetadataList{}
+	replicaSets.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("ReplicaSetList"))
+	if err := r.List(ctx, replicaSets, client.InNamespace(namespace)); err != nil {
+		return 0, err
+	}
+	for i := range replicaSets.Items {
+		if controller := metav1.GetControllerOf(&replicaSets.Items[i]); controller != nil && owners.Has(controller.UID) {
+			owners.Insert(replicaSets.Items[i].UID)
+		}
+	}
+
+	pods := &metav1.PartialObjectMetadataList{}
+	pods.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PodList"))
+	if err := r.List(ctx, pods, client.InNamespace(namespace)); err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := range pods.Items {
+		if controller := metav1.GetControllerOf(&pods.Items[i]); controller != nil && owners.Has(controller.UID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// deleteRedisClaims deletes the PersistentVolumeClaims of the persistent Redis of myApp, once asked to by deleteClaims.
+// They have no controller, as the StatefulSet keeps them once it is deleted, so the ones carrying the MyAppResource
+// label of myApp are deleted.
+func (r *MyAppResourceReconciler) deleteRedisClaims(ctx context.Context, myApp *podinfov1alpha1.MyAppResource) error {
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(myApp.Namespace),
+		client.MatchingLabels{podinfov1alpha1.MyAppResourceLabelName: myApp.Name}); err != nil {
+		return err
+	}
+	prefix := redisDataVolume + "-" + myApp.Name + redisNamePostfix + "-"
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if !strings.HasPrefix(claim.Name, prefix) {
+			continue
+		}
+		log.FromContext(ctx).V(1).Info("Deleting Redis PersistentVolumeClaim", "persistentvolumeclaim", claim.Name)
+		uid := claim.UID
+		if err := r.Delete(ctx, claim, client.Preconditions{UID: &uid}); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.recordChildWrite(myApp, writeVerbDelete, "PersistentVolumeClaim", claim.Name)
+	}
+	return nil
+}
+
+// deleteOwned deletes the named child of myApp, skipping kinds that are not installed. Objects that are not children
+// of myApp are left in place.
+func (r *MyAppResourceReconciler) deleteOwned(ctx context.Context, myApp *podinfov1alpha1.MyAppResource, c child) error {
+	if !r.kindInstalled(c.obj) {
+		return nil
+	}
+	return r.deleteIfExists(ctx, myApp, c.obj, c.name)
+}
+
+// setTerminatingCondition reports the teardown step in progress in the myApp status.
+func (r *MyAppResourceReconciler) setTerminatingCondition(
+	ctx context.Context, myApp *podinfov1alpha1.MyAppResource, reason, message string,
+) error {
+	original := myApp.DeepCopy()
+	meta.SetStatusCondition(&myApp.Status.Conditions, metav1.Condition{
+		Type:               podinfov1alpha1.ConditionTerminating,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: myApp.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	meta.SetStatusCondition(&myApp.Status.Conditions, metav1.Condition{
+		Type:               podinfov1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: myApp.Generation,
+		Reason:             reasonTerminating,
+		Message:            "the myappresource is being deleted",
+	})
+	myApp.Status.Ready = false
+	if equality.Semantic.DeepEqual(original.Status, myApp.Status) {
+		return nil
+	}
+	if err := r.Status().Patch(ctx, myApp, client.MergeFrom(original)); err != nil {
+		return fmt.Errorf("error patching myappresource status: %w", err)
+	}
+	return nil
+}
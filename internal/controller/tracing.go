@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	k8serrs "k8s.io/apimachinery/pkg/api/errors"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// tracerName is the instrumentation scope of the reconciler's spans.
+const tracerName = "podinfo-operator.com/m/v2/internal/controller"
+
+// Attributes of the reconciler's spans.
+const (
+	attrMyAppName       = attribute.Key("myappresource.name")
+	attrMyAppNamespace  = attribute.Key("myappresource.namespace")
+	attrMyAppGeneration = attribute.Key("myappresource.generation")
+	attrResourceKind    = attribute.Key("k8s.resource.kind")
+	attrResourceName    = attribute.Key("k8s.resource.name")
+	attrApplyResult     = attribute.Key("apply.result")
+	attrConflict        = attribute.Key("myappresource.conflict")
+	attrRequeue         = attribute.Key("reconcile.requeue")
+	attrRequeueAfter    = attribute.Key("reconcile.requeue_after")
+)
+
+// tracer returns the tracer of the reconciler's spans, from TracerProvider or else the global provider.
+func (r *MyAppResourceReconciler) tracer() trace.Tracer {
+	provider := otel.GetTracerProvider()
+	if r.TracerProvider != nil {
+		provider = r.TracerProvider
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startSpan starts the span of a reconcile step of myApp, carrying the attributes of myApp and attrs.
+func (r *MyAppResourceReconciler) startSpan(
+	ctx context.Context, name string, myApp *podinfov1alpha1.MyAppResource, attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	attrs = append([]attribute.KeyValue{
+		attrMyAppName.String(myApp.Name),
+		attrMyAppNamespace.String(myApp.Namespace),
+		attrMyAppGeneration.Int64(myApp.Generation),
+	}, attrs...)
+	return r.tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span with the outcome of its step. A child the myappresource does not own, or a write the API server
+// rejected for a stale resourceVersion, is flagged as a conflict, so time lost to conflicts can be told apart from
+// failing API calls.
+func endSpan(span trace.Span, err error) {
+	switch {
+	case isConflict(err) || k8serrs.IsConflict(err):
+		span.SetAttributes(attrConflict.Bool(true))
+		span.SetStatus(codes.Error, err.Error())
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
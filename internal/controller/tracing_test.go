@@ -0,0 +1,182 @@
+/*
+Copyright 2024 Joshua Reed.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR  CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	k8serrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podinfov1alpha1 "podinfo-operator.com/m/v2/api/v1alpha1"
+)
+
+// spanAttributes returns the attributes of span by key.
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+// findSpans returns the spans named name.
+func findSpans(spans tracetest.SpanStubs, name string) tracetest.SpanStubs {
+	var found tracetest.SpanStubs
+	for _, span := range spans {
+		if span.Name == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+var _ = Describe("MyAppResource Tracing", func() {
+	const (
+		resourceName = "traced-resource"
+		namespace    = "tracing"
+	)
+
+	ctx := context.Background()
+	namespacedName := types.NamespacedName{Name: resourceName, Namespace: namespace}
+
+	var (
+		exporter             *tracetest.InMemoryExporter
+		controllerReconciler *MyAppResourceReconciler
+	)
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		controllerReconciler = &MyAppResourceReconciler{
+			Client:         k8sClient,
+			Scheme:         k8sClient.Scheme(),
+			TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+		}
+
+		namespaceObj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+		Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespaceObj))).To(Succeed())
+		Expect(k8sClient.Create(ctx, &podinfov1alpha1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+			Spec: podinfov1alpha1.MyAppResourceSpec{
+				ReplicaCount: ptr(int32(1)),
+				Image: podinfov1alpha1.Image{
+					Repository: "ghcr.io/stefanprodan/podinfo",
+					Tag:        "latest",
+				},
+				Redis: podinfov1alpha1.Redis{Enabled: true},
+			},
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		tearDown(ctx, namespacedName)
+		for _, name := range []string{resourceName, resourceName + redisNamePostfix} {
+			svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, svc))).To(Succeed())
+		}
+	})
+
+	It("should trace every step of a reconcile under one span", func() {
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+		Expect(err).NotTo(HaveOccurred())
+
+		spans := exporter.GetSpans()
+		roots := findSpans(spans, "Reconcile")
+		Expect(roots).To(HaveLen(1))
+		root := roots[0]
+		Expect(spanAttributes(root)).To(HaveKeyWithValue(attrMyAppName, attribute.StringValue(resourceName)))
+		Expect(spanAttributes(root)).To(HaveKeyWithValue(attrMyAppNamespace, attribute.StringValue(namespace)))
+
+		By("parenting each step on the reconcile")
+		for _, step := range []string{"createOrUpdateDeployment", "createOrUpdateService", "reconcileRedis",
+			"createOrUpdateRedisDeployment", "createOrUpdateRedisService", "updateStatus"} {
+			steps := findSpans(spans, step)
+			Expect(steps).To(HaveLen(1), step)
+			Expect(steps[0].SpanContext.TraceID()).To(Equal(root.SpanContext.TraceID()), step)
+			Expect(spanAttributes(steps[0])).To(HaveKeyWithValue(attrMyAppName, attribute.StringValue(resourceName)))
+		}
+		redisDeployment := findSpans(spans, "createOrUpdateRedisDeployment")[0]
+		Expect(redisDeployment.Parent.SpanID()).To(Equal(findSpans(spans, "reconcileRedis")[0].SpanContext.SpanID()))
+
+		By("naming the resource of every apply")
+		deployment := findSpans(spans, "createOrUpdateDeployment")[0]
+		var applies []map[attribute.Key]attribute.Value
+		for _, apply := range findSpans(spans, "apply") {
+			if apply.Parent.SpanID() == deployment.SpanContext.SpanID() {
+				applies = append(applies, spanAttributes(apply))
+			}
+		}
+		Expect(applies).To(HaveLen(1))
+		Expect(applies[0]).To(HaveKeyWithValue(attrResourceKind, attribute.StringValue("Deployment")))
+		Expect(applies[0]).To(HaveKeyWithValue(attrResourceName, attribute.StringValue(resourceName)))
+		Expect(applies[0]).To(HaveKeyWithValue(attrApplyResult, attribute.StringValue(applyResultApplied)))
+
+		By("marking unchanged children as skipped on the next reconcile")
+		exporter.Reset()
+		_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+		Expect(err).NotTo(HaveOccurred())
+		for _, apply := range findSpans(exporter.GetSpans(), "apply") {
+			Expect(spanAttributes(apply)).To(HaveKeyWithValue(attrApplyResult, attribute.StringValue(applyResultSkipped)))
+		}
+	})
+
+	It("should flag the step held up by a conflict, and the requeue", func() {
+		Expect(k8sClient.Create(ctx, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "web", Port: 8080}}},
+		})).To(Succeed())
+
+		result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(conflictRequeueInterval))
+
+		spans := exporter.GetSpans()
+		service := findSpans(spans, "createOrUpdateService")
+		Expect(service).To(HaveLen(1))
+		Expect(service[0].Status.Code).To(Equal(codes.Error))
+		Expect(spanAttributes(service[0])).To(HaveKeyWithValue(attrConflict, attribute.BoolValue(true)))
+		Expect(findSpans(spans, "reconcileRedis")).To(HaveLen(1))
+
+		root := findSpans(spans, "Reconcile")[0]
+		Expect(root.Status.Code).To(Equal(codes.Unset))
+		Expect(spanAttributes(root)).To(HaveKeyWithValue(attrRequeueAfter,
+			attribute.StringValue(conflictRequeueInterval.String())))
+	})
+
+	It("should flag a write the API server rejected as conflicting", func() {
+		_, span := controllerReconciler.tracer().Start(ctx, "updateStatus")
+		endSpan(span, k8serrs.NewConflict(podinfov1alpha1.GroupVersion.WithResource("myappresources").GroupResource(),
+			resourceName, errors.New("the object has been modified")))
+
+		spans := findSpans(exporter.GetSpans(), "updateStatus")
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Status.Code).To(Equal(codes.Error))
+		Expect(spanAttributes(spans[0])).To(HaveKeyWithValue(attrConflict, attribute.BoolValue(true)))
+	})
+})